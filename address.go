@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hymkor/binview/internal/large"
+)
+
+// addressParser evaluates the expression typed at the Goto prompt.
+//
+//	expr    := ['+'|'-'] term { ('+'|'-') term }   leading sign: relative to cursor
+//	term    := unary { ('*'|'/'|'%') unary }
+//	unary   := '-' unary | primary
+//	primary := number | '$' | '.' | "'" mark | '(' expr ')' | '*' type [ primary ]
+//	type    := u8 | i8 | (u|i)(16|32|64)(le|be)
+type addressParser struct {
+	app  *Application
+	text string
+	pos  int
+}
+
+var (
+	rxAddressNumber = regexp.MustCompile(`^(?:0[xX][0-9A-Fa-f_]+|0[bB][01_]+|0[oO]?[0-7_]+|[0-9][0-9_]*)`)
+	rxIntegerType   = regexp.MustCompile(`^([uUiI])(8|16|32|64)([lLbB][eE])?`)
+)
+
+func (p *addressParser) skipSpaces() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *addressParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+func (p *addressParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("column %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *addressParser) expr() (int64, error) {
+	value, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case '+':
+			p.pos++
+			rhs, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			value += rhs
+		case '-':
+			p.pos++
+			rhs, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			value -= rhs
+		default:
+			return value, nil
+		}
+	}
+}
+
+func (p *addressParser) term() (int64, error) {
+	value, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			value *= rhs
+		case '/', '%':
+			if rhs == 0 {
+				return 0, errors.New("division by zero")
+			}
+			if op == '/' {
+				value /= rhs
+			} else {
+				value %= rhs
+			}
+		}
+	}
+}
+
+func (p *addressParser) unary() (int64, error) {
+	if p.peek() == '-' {
+		p.pos++
+		value, err := p.unary()
+		return -value, err
+	}
+	return p.primary()
+}
+
+func (p *addressParser) primary() (int64, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return 0, p.errorf("value expected")
+	case c == '(':
+		p.pos++
+		value, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, p.errorf("`)` expected")
+		}
+		p.pos++
+		return value, nil
+	case c == '$':
+		p.pos++
+		p.app.buffer.ReadAll()
+		return p.app.buffer.Len() - 1, nil
+	case c == '.':
+		p.pos++
+		return p.app.cursor.Address(), nil
+	case c == '\'':
+		p.pos++
+		if p.pos >= len(p.text) {
+			return 0, p.errorf("mark name expected")
+		}
+		name := rune(p.text[p.pos])
+		p.pos++
+		address, ok := p.app.marks[name]
+		if !ok {
+			return 0, fmt.Errorf("mark '%c' is not set", name)
+		}
+		return address, nil
+	case c == '*':
+		p.pos++
+		return p.dereference()
+	}
+	m := rxAddressNumber.FindString(p.text[p.pos:])
+	if m == "" {
+		return 0, p.errorf("unexpected `%s`", p.text[p.pos:])
+	}
+	value, err := strconv.ParseInt(m, 0, 64)
+	if err != nil {
+		return 0, err
+	}
+	p.pos += len(m)
+	return value, nil
+}
+
+// dereference reads the integer `*type` points to: the address in the
+// following primary, or the cursor when no operand is given.
+func (p *addressParser) dereference() (int64, error) {
+	m := rxIntegerType.FindStringSubmatch(p.text[p.pos:])
+	if m == nil {
+		return 0, p.errorf("type (u8,u16le,u32be,...) expected after `*`")
+	}
+	size, _ := strconv.Atoi(m[2])
+	size /= 8
+	if size > 1 && m[3] == "" {
+		return 0, p.errorf("`%s` needs the suffix le or be", m[0])
+	}
+	p.pos += len(m[0])
+
+	at := p.app.cursor.Address()
+	if c := p.peek(); c != 0 && c != ')' && strings.IndexByte("+-*/%", c) < 0 {
+		var err error
+		at, err = p.primary()
+		if err != nil {
+			return 0, err
+		}
+	}
+	isLittleEndian := strings.EqualFold(m[3], "le")
+	value, err := readInteger(p.app.buffer, at, size, isLittleEndian)
+	if err != nil {
+		return 0, err
+	}
+	if m[1] == "i" || m[1] == "I" {
+		shift := 64 - 8*size
+		return int64(value<<shift) >> shift, nil
+	}
+	return int64(value), nil
+}
+
+// readInteger reads the size-byte integer stored at the address.
+func readInteger(buffer *large.Buffer, at int64, size int, isLittleEndian bool) (uint64, error) {
+	if at < 0 {
+		return 0, fmt.Errorf("0x%X: out of range", at)
+	}
+	p := large.NewPointerAt(at, buffer)
+	if p == nil || p.Address() != at {
+		return 0, fmt.Errorf("0x%X: out of range", at)
+	}
+	var value uint64
+	for i := 0; i < size; i++ {
+		if i > 0 && p.Next() != nil {
+			return 0, fmt.Errorf("0x%X: %d bytes are not available", at, size)
+		}
+		if isLittleEndian {
+			value |= uint64(p.Value()) << (8 * i)
+		} else {
+			value = (value << 8) | uint64(p.Value())
+		}
+	}
+	return value, nil
+}
+
+// evalAddress evaluates the expression for the Goto command.
+// An expression starting with `+` or `-` is relative to the cursor.
+func evalAddress(exp string, app *Application) (int64, error) {
+	p := &addressParser{app: app, text: exp}
+	var base int64
+	if c := p.peek(); c == '+' || c == '-' {
+		base = app.cursor.Address()
+		if c == '+' {
+			p.pos++
+		}
+	}
+	value, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != 0 {
+		return 0, p.errorf("unexpected `%s`", p.text[p.pos:])
+	}
+	return base + value, nil
+}
+
+// pointerType describes how the follow-pointer command reads the offset
+// stored at the cursor.
+type pointerType struct {
+	size           int
+	isLittleEndian bool
+	base           int64
+}
+
+func (pt pointerType) String() string {
+	endian := "be"
+	if pt.isLittleEndian {
+		endian = "le"
+	}
+	s := fmt.Sprintf("u%d%s", pt.size*8, endian)
+	if pt.base != 0 {
+		s += fmt.Sprintf("+0x%X", pt.base)
+	}
+	return s
+}
+
+// parsePointerType parses the text like `u32le` or `u64be+0x400`.
+// The expression after `+` is the base address the value is relative to.
+func parsePointerType(text string, app *Application) (pointerType, error) {
+	text = strings.TrimSpace(text)
+	m := rxIntegerType.FindStringSubmatch(text)
+	if m == nil || m[1] != "u" && m[1] != "U" || m[2] == "8" || m[3] == "" {
+		return pointerType{}, fmt.Errorf("%s: expect u16le,u16be,u32le,u32be,u64le or u64be", text)
+	}
+	size, _ := strconv.Atoi(m[2])
+	pt := pointerType{
+		size:           size / 8,
+		isLittleEndian: strings.EqualFold(m[3], "le"),
+	}
+	if rest := strings.TrimSpace(text[len(m[0]):]); rest != "" {
+		if rest[0] != '+' {
+			return pointerType{}, fmt.Errorf("`%s`: `+` expected", rest)
+		}
+		base, err := evalAddress(rest[1:], app)
+		if err != nil {
+			return pointerType{}, err
+		}
+		pt.base = base
+	}
+	return pt, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/hymkor/binview/internal/large"
+)
+
+// binaryFormat is the layout of the hex part in the bit view.
+var binaryFormat = byteFormats[3]
+
+// bitSession is the state of the bit view (`b`). The bytes are shown in
+// binary and the cursor moves per bit.
+type bitSession struct {
+	bit int // 0: the most significant bit, 7: the least significant one
+}
+
+// setBit changes the bit under the cursor and registers its undo.
+func (bs *bitSession) setBit(app *Application, on bool) {
+	address := app.cursor.Address()
+	orgValue := app.cursor.Value()
+	orgDirty := app.dirty
+	mask := byte(0x80) >> bs.bit
+	newValue := orgValue &^ mask
+	if on {
+		newValue |= mask
+	}
+	if newValue == orgValue {
+		return
+	}
+	undo := func(app *Application) {
+		p := large.NewPointerAt(address, app.buffer)
+		p.SetValue(orgValue)
+		app.dirty = orgDirty
+	}
+	app.undoFuncs = append(app.undoFuncs, undo)
+	app.cursor.SetValue(newValue)
+	app.dirty = true
+}
+
+func (bs *bitSession) forward(app *Application) {
+	if bs.bit < 7 {
+		bs.bit++
+	} else if app.cursor.Next() == nil {
+		bs.bit = 0
+	}
+}
+
+func (bs *bitSession) backward(app *Application) {
+	if bs.bit > 0 {
+		bs.bit--
+	} else if app.cursor.Prev() == nil {
+		bs.bit = 7
+	}
+}
+
+// Key processes the key in the bit view. It returns false when the key
+// should be processed by the jumpTable (e.g. moving to another line, undo).
+func (bs *bitSession) Key(app *Application, key string) bool {
+	switch key {
+	case _KEY_ESC, "b":
+		app.bitView = nil
+	case "h", _KEY_LEFT, _KEY_CTRL_B, _KEY_BACKSPACE, _KEY_DEL_ASCII:
+		bs.backward(app)
+	case "l", _KEY_RIGHT, _KEY_CTRL_F:
+		bs.forward(app)
+	case " ", _KEY_ENTER:
+		mask := byte(0x80) >> bs.bit
+		bs.setBit(app, app.cursor.Value()&mask == 0)
+	case "0", "1":
+		bs.setBit(app, key == "1")
+		bs.forward(app)
+	default:
+		return false
+	}
+	return true
+}
+
+// keyFuncBitView starts the bit view.
+func keyFuncBitView(app *Application) error {
+	if app.typing != nil {
+		app.typing.finish(app)
+	}
+	app.bitView = &bitSession{}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+// command is a function which keys can be bound to by its name.
+// The names are stable and used by the config file.
+type command struct {
+	name     string
+	f        func(*Application) error
+	help     string
+	category string // one of categories
+}
+
+// categories are the groups of the commands in the help screen.
+var categories = []string{"Move", "Jump", "Edit", "File", "Encoding", "View", "Command"}
+
+// commands is the list of all commands in the order of the help.
+var commands = []*command{
+	{"quit", keyFuncQuit, "Quit", "File"},
+	{"backward", keyFuncBackword, "Move the cursor left", "Move"},
+	{"next-line", keyFuncNext, "Move the cursor down", "Move"},
+	{"previous-line", keyFuncPrevious, "Move the cursor up", "Move"},
+	{"forward", keyFuncForward, "Move the cursor right", "Move"},
+	{"beginning-of-line", keyFuncGoBeginOfLine, "Move the cursor to the beginning of the current line", "Move"},
+	{"end-of-line", keyFuncGoEndOfLine, "Move the cursor to the end of the current line", "Move"},
+	{"beginning-of-file", keyFuncGoBeginOfFile, "Move the cursor to the beginning of the file", "Move"},
+	{"end-of-file", keyFuncGoEndOfFile, "Move the cursor to the end of the file", "Move"},
+	{"replace-byte", keyFuncReplaceByte, "Replace the byte under the cursor", "Edit"},
+	{"replace-mode", keyFuncReplaceMode, "Overwrite the data by typing hex digits", "Edit"},
+	{"insert-mode", keyFuncInsertMode, "Insert the data by typing hex digits", "Edit"},
+	{"text-mode", keyFuncTextMode, "Overwrite the data by typing characters", "Edit"},
+	{"bit-view", keyFuncBitView, "Show the bytes in binary and edit them per bit", "Edit"},
+	{"insert-data", keyFuncInsertExp, "Insert data (e.g., 0xFF, U+0000, \"string\")", "Edit"},
+	{"append-data", keyFuncAppendExp, "Append data (e.g., 0xFF, U+0000, \"string\")", "Edit"},
+	{"remove-byte", keyFuncRemoveByte, "Delete and yank the byte under the cursor", "Edit"},
+	{"paste-after", keyFuncPasteAfter, "Paste one byte to the right side of the cursor", "Edit"},
+	{"paste-before", keyFuncPasteBefore, "Paste one byte to the left side of the cursor", "Edit"},
+	{"undo", keyFuncUndo, "Undo", "Edit"},
+	{"write-file", keyFuncWriteFile, "Write changes to file", "File"},
+	{"goto", keyFuncGoTo, "Jump to the address given by an expression", "Jump"},
+	{"set-mark", keyFuncSetMark, "Set a mark at the cursor", "Jump"},
+	{"jump-to-mark", keyFuncJumpToMark, "Jump to the mark", "Jump"},
+	{"follow-pointer", keyFuncFollowPointer, "Jump to the offset under the cursor", "Jump"},
+	{"return-from-pointer", keyFuncReturnFromPointer, "Return to where the last pointer was followed from", "Jump"},
+	{"set-pointer-type", keyFuncSetPointerType, "Set the type of the pointer to follow", "Jump"},
+	{"next-invalid", keyFuncNextInvalid, "Jump to the next byte sequence which can not be decoded", "Jump"},
+	{"utf8-mode", keyFuncUtf8Mode, "Change the encoding to UTF-8", "Encoding"},
+	{"ansi-mode", keyFuncDbcsMode, "Change the encoding to the one of the locale", "Encoding"},
+	{"utf16le-mode", keyFuncUtf16LeMode, "Change the encoding to UTF-16LE", "Encoding"},
+	{"utf16be-mode", keyFuncUtf16BeMode, "Change the encoding to UTF-16BE", "Encoding"},
+	{"utf32le-mode", keyFuncUtf32LeMode, "Change the encoding to UTF-32LE", "Encoding"},
+	{"utf32be-mode", keyFuncUtf32BeMode, "Change the encoding to UTF-32BE", "Encoding"},
+	{"detect-encoding", keyFuncDetectEncoding, "Detect the encoding again from the data after the cursor", "Encoding"},
+	{"select-encoding", keyFuncSelectEncoding, "Select the encoding from the list", "Encoding"},
+	{"select-second-encoding", keyFuncSelectEncoding2, "Show the second character part with another encoding", "Encoding"},
+	{"cycle-byte-format", keyFuncCycleByteFormat, "Switch the bytes between hex, octal, decimal and binary", "View"},
+	{"repaint", keyFuncRepaint, "Repaint the screen", "View"},
+	{"help", keyFuncHelp, "Show the keys and the commands", "View"},
+}
+
+// lookupCommand returns the command of the name.
+func lookupCommand(name string) (*command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
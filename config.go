@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hymkor/binview/internal/encoding"
+)
+
+// readKeyValues calls set for each line `key = value` of r. Empty lines
+// and lines starting with `#` are skipped.
+func readKeyValues(r io.Reader, set func(key, value string) error) error {
+	sc := bufio.NewScanner(r)
+	for lnum := 1; sc.Scan(); lnum++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: `=` is missing", lnum)
+		}
+		if err := set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("line %d: %w", lnum, err)
+		}
+	}
+	return sc.Err()
+}
+
+// keyNames are the names of the keys for `bind` in the config file.
+var keyNames = map[string]string{
+	"SPACE":     " ",
+	"ESC":       _KEY_ESC,
+	"ESCAPE":    _KEY_ESC,
+	"ENTER":     _KEY_ENTER,
+	"TAB":       _KEY_TAB,
+	"BACKSPACE": _KEY_BACKSPACE,
+	"DEL":       _KEY_DEL,
+	"DELETE":    _KEY_DEL,
+	"INSERT":    _KEY_INSERT,
+	"UP":        _KEY_UP,
+	"DOWN":      _KEY_DOWN,
+	"LEFT":      _KEY_LEFT,
+	"RIGHT":     _KEY_RIGHT,
+	"F1":        _KEY_F1,
+	"F2":        _KEY_F2,
+}
+
+// parseKeyName converts the name of the key like `x`, `C-x`, `M-x`,
+// `ENTER` to the sequence which the terminal sends.
+func parseKeyName(name string) (string, error) {
+	if len([]rune(name)) == 1 {
+		return name, nil
+	}
+	if key, ok := keyNames[strings.ToUpper(name)]; ok {
+		return key, nil
+	}
+	if len(name) == 3 && name[1] == '-' {
+		switch c := name[2]; name[0] {
+		case 'C', 'c':
+			if 'a' <= c && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			if '@' <= c && c <= '_' {
+				return string([]byte{c - '@'}), nil
+			}
+		case 'M', 'm':
+			return "\x1B" + name[2:], nil
+		}
+	}
+	return "", fmt.Errorf("%s: unknown key", name)
+}
+
+// backupPolicy is how the file is backed up on overwriting it:
+// "tilde" keeps it as `NAME~` and "none" removes it after writing.
+var backupPolicy = "tilde"
+
+// config is the settings read from the config file.
+type config struct {
+	encoding   encoding.Encoding // nil: detected from the data
+	lineSize   int               // 0: LINE_SIZE
+	byteFormat int
+	theme      string
+	pointer    string
+	backup     string
+	screen     string
+	mouse      string
+	bindings   map[string]string // "": unbound
+}
+
+func indexOfByteFormat(name string) int {
+	for i, f := range byteFormats {
+		if strings.EqualFold(f.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// set sets the value of the key other than `bind`.
+func (conf *config) set(key, value string) error {
+	switch strings.ToLower(key) {
+	case "encoding":
+		if strings.EqualFold(value, "auto") {
+			conf.encoding = nil
+			return nil
+		}
+		enc, ok := encoding.Lookup(value)
+		if !ok {
+			return fmt.Errorf("%s: no such encoding", value)
+		}
+		conf.encoding = enc
+	case "width":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 256 {
+			return fmt.Errorf("%s: width must be 1 to 256", value)
+		}
+		conf.lineSize = n
+	case "format":
+		i := indexOfByteFormat(value)
+		if i < 0 {
+			return fmt.Errorf("%s: no such format", value)
+		}
+		conf.byteFormat = i
+	case "theme":
+		conf.theme = value
+	case "pointer":
+		conf.pointer = value
+	case "backup":
+		if value != "tilde" && value != "none" {
+			return fmt.Errorf("%s: backup must be tilde or none", value)
+		}
+		conf.backup = value
+	case "screen":
+		if value != "inline" && value != "full" {
+			return fmt.Errorf("%s: screen must be inline or full", value)
+		}
+		conf.screen = value
+	case "mouse":
+		if value != "on" && value != "off" && value != "auto" {
+			return fmt.Errorf("%s: mouse must be on, off or auto", value)
+		}
+		conf.mouse = value
+	default:
+		return fmt.Errorf("%s: unknown key", key)
+	}
+	return nil
+}
+
+// readConfig reads the config file. Each line is one of:
+//
+//	encoding = NAME|auto
+//	width    = BYTES PER LINE
+//	format   = hex|oct|dec|bin
+//	theme    = NAME|PATH
+//	pointer  = TYPE (e.g. u32le)
+//	backup   = tilde|none
+//	screen   = inline|full
+//	mouse    = on|off|auto
+//	bind KEY = COMMAND|none
+func readConfig(r io.Reader) (*config, error) {
+	conf := &config{bindings: map[string]string{}}
+	err := readKeyValues(r, func(key, value string) error {
+		if keyName, ok := strings.CutPrefix(key, "bind "); ok {
+			k, err := parseKeyName(strings.TrimSpace(keyName))
+			if err != nil {
+				return err
+			}
+			if value == "none" {
+				conf.bindings[k] = ""
+				return nil
+			}
+			if _, ok := lookupCommand(value); !ok {
+				return fmt.Errorf("%s: no such command", value)
+			}
+			conf.bindings[k] = value
+			return nil
+		}
+		return conf.set(key, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// configPath returns the path of the config file in the user's config
+// directory ($XDG_CONFIG_HOME/binview/config, %APPDATA%\binview\config).
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "binview", "config"), nil
+}
+
+// loadConfig reads the config file of the path. When path is empty, it
+// reads the one in the user's config directory if it exists.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		var err error
+		path, err = configPath()
+		if err != nil {
+			return &config{}, nil
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return &config{}, nil
+		}
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	conf, err := readConfig(fd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return conf, nil
+}
+
+// apply applies the settings to the application.
+func (conf *config) apply(app *Application) error {
+	if conf.encoding != nil {
+		app.setEncoding(conf.encoding)
+	}
+	if conf.lineSize > 0 {
+		app.maxLineSize = conf.lineSize
+	}
+	app.byteFormat = conf.byteFormat
+	if conf.pointer != "" {
+		t, err := parsePointerType(conf.pointer, app)
+		if err != nil {
+			return err
+		}
+		app.pointerType = t
+	}
+	if conf.backup != "" {
+		backupPolicy = conf.backup
+	}
+	if conf.screen != "" {
+		app.fullScreen = conf.screen == "full"
+	}
+	if conf.mouse != "" {
+		app.mouse = conf.mouse
+	}
+	for key, name := range conf.bindings {
+		if name == "" {
+			delete(jumpTable, key)
+		} else {
+			jumpTable[key] = name
+		}
+	}
+	return nil
+}
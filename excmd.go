@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/simplehistory"
+
+	"github.com/hymkor/binview/internal/large"
+	"github.com/hymkor/binview/internal/nonblock"
+)
+
+// exCommands are the commands for the command line (`:`). They are
+// registered to commands by init because they refer to commands.
+var exCommands = []*command{
+	{"ex-command", keyFuncExCommand, "Run a command by its name with arguments (e.g., :goto 0x100)", "Command"},
+	{"set", keyFuncSet, "Change a setting of the config file (e.g., :set width=32)", "Command"},
+	{"fill", keyFuncFill, "Overwrite bytes with a byte (e.g., :fill 0x00 16)", "Edit"},
+	{"force-quit", keyFuncForceQuit, "Quit without asking", "File"},
+}
+
+func init() {
+	commands = append(commands, exCommands...)
+}
+
+// exFuncs are the functions called instead of the ones of commands when
+// arguments are given on the command line.
+var exFuncs = map[string]func(*Application, string) error{
+	"write-file":       exWriteFile,
+	"goto":             exGoTo,
+	"select-encoding":  exSelectEncoding,
+	"set-pointer-type": exSetPointerType,
+	"insert-data":      exInsertExp,
+	"append-data":      exAppendExp,
+	"set":              exSet,
+	"fill":             exFill,
+}
+
+// exAliases are the short names of the commands on the command line.
+var exAliases = map[string]string{
+	"w":   "write-file",
+	"q":   "quit",
+	"q!":  "force-quit",
+	"enc": "select-encoding",
+}
+
+// exCommandNames returns the names which the command line accepts.
+func exCommandNames() []string {
+	names := make([]string, 0, len(commands)+len(exAliases))
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	for alias := range exAliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeCommandName completes the command name before the cursor by
+// the longest common prefix of the candidates.
+func completeCommandName(_ context.Context, B *readline.Buffer) readline.Result {
+	word := B.SubString(0, B.Cursor)
+	if strings.ContainsRune(word, ' ') {
+		return readline.CONTINUE
+	}
+	var found []string
+	for _, name := range exCommandNames() {
+		if strings.HasPrefix(name, word) {
+			found = append(found, name)
+		}
+	}
+	if len(found) <= 0 {
+		return readline.CONTINUE
+	}
+	common := found[0]
+	for _, name := range found[1:] {
+		for !strings.HasPrefix(name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(found) == 1 {
+		common += " "
+	}
+	B.ReplaceAndRepaint(0, common)
+	return readline.CONTINUE
+}
+
+var exHistory = simplehistory.New()
+
+// exPrompt reads a command line with defaultStr and runs it.
+func (app *Application) exPrompt(defaultStr string) error {
+	worker := nonblock.New(func() (string, error) {
+		return getlineWithCompletion(app.out, ":", defaultStr, exHistory,
+			readline.AnonymousCommand(completeCommandName))
+	})
+	line, err := getOrLoad(worker, app.buffer)
+	worker.Close()
+	if err != nil {
+		app.message = err.Error()
+		return nil
+	}
+	exHistory.Add(line)
+	return app.execute(line)
+}
+
+// execute runs the command line `NAME [ARGUMENTS]`. Without arguments,
+// it is the same as the key bound to the command, which asks them.
+func (app *Application) execute(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	if name == "" {
+		return nil
+	}
+	if fullName, ok := exAliases[name]; ok {
+		name = fullName
+	}
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		app.message = name + ": no such command"
+		return nil
+	}
+	if ex, ok := exFuncs[name]; ok && arg != "" {
+		return ex(app, arg)
+	}
+	if arg != "" {
+		app.message = name + ": takes no arguments"
+		return nil
+	}
+	return cmd.f(app)
+}
+
+func keyFuncExCommand(app *Application) error {
+	return app.exPrompt("")
+}
+
+func keyFuncSet(app *Application) error {
+	return app.exPrompt("set ")
+}
+
+func keyFuncFill(app *Application) error {
+	return app.exPrompt("fill ")
+}
+
+// setOption changes the setting as the line `key = value` of the config
+// file does.
+func (app *Application) setOption(key, value string) error {
+	conf := &config{byteFormat: app.byteFormat, bindings: map[string]string{}}
+	if err := conf.set(key, value); err != nil {
+		return err
+	}
+	switch strings.ToLower(key) {
+	case "encoding":
+		if conf.encoding == nil {
+			return keyFuncDetectEncoding(app)
+		}
+		app.setEncoding(conf.encoding)
+		return nil
+	case "theme":
+		return loadTheme(conf.theme)
+	}
+	return conf.apply(app)
+}
+
+// exSet is `:set KEY=VALUE...`.
+func exSet(app *Application, arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) <= 0 {
+		app.message = "usage: set KEY=VALUE..."
+		return nil
+	}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			app.message = field + ": `=` is missing"
+			return nil
+		}
+		if err := app.setOption(key, value); err != nil {
+			app.message = err.Error()
+			return nil
+		}
+	}
+	return nil
+}
+
+// exFill is `:fill BYTE [COUNT]`. It overwrites COUNT bytes from the
+// cursor, or the selected bytes without COUNT, with BYTE, but does not
+// extend the data.
+func exFill(app *Application, arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) < 1 || len(fields) > 2 {
+		app.message = "usage: fill BYTE [COUNT]"
+		return nil
+	}
+	value, err := strconv.ParseUint(fields[0], 0, 8)
+	if err != nil {
+		app.message = err.Error()
+		return nil
+	}
+	address := app.cursor.Address()
+	count := int64(1)
+	if sel := app.selectedRange(); sel.end > sel.start && len(fields) < 2 {
+		address = sel.start
+		count = sel.end - sel.start
+		app.selection = nil
+	}
+	if len(fields) >= 2 {
+		count, err = strconv.ParseInt(fields[1], 0, 64)
+		if err != nil || count < 1 {
+			app.message = fields[1] + ": invalid count"
+			return nil
+		}
+	}
+	orgDirty := app.dirty
+	var orgValues []byte
+	p := large.NewPointerAt(address, app.buffer)
+	for {
+		orgValues = append(orgValues, p.Value())
+		p.SetValue(byte(value))
+		if int64(len(orgValues)) >= count || p.Next() != nil {
+			break
+		}
+	}
+	undo := func(app *Application) {
+		p := large.NewPointerAt(address, app.buffer)
+		for _, v := range orgValues {
+			p.SetValue(v)
+			p.Next()
+		}
+		app.dirty = orgDirty
+	}
+	app.undoFuncs = append(app.undoFuncs, undo)
+	app.dirty = true
+	if n := int64(len(orgValues)); n < count {
+		app.message = fmt.Sprintf("%d bytes filled up to the end", n)
+	}
+	return nil
+}
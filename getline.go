@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
 
 	"github.com/nyaosorg/go-readline-ny"
 	"github.com/nyaosorg/go-readline-ny/keys"
@@ -15,12 +18,17 @@ import (
 type Tty = ttyadapter.Tty
 
 func getline(out io.Writer, prompt string, defaultStr string, history readline.IHistory) (string, error) {
+	return getlineWithCompletion(out, prompt, defaultStr, history, nil)
+}
+
+// getlineWithCompletion is getline which calls complete on TAB.
+func getlineWithCompletion(out io.Writer, prompt string, defaultStr string, history readline.IHistory, complete readline.Command) (string, error) {
 	editor := readline.Editor{
 		Writer:  out,
 		Default: defaultStr,
 		Cursor:  65535,
 		PromptWriter: func(w io.Writer) (int, error) {
-			fmt.Fprintf(w, "\r\x1B[0;33;40;1m%s%s", prompt, _ANSI_ERASE_LINE)
+			fmt.Fprintf(w, "\r%s%s%s", _STATUS_COLOR_ON, prompt, _ANSI_ERASE_LINE)
 			return 2, nil
 		},
 		LineFeedWriter: func(readline.Result, io.Writer) (int, error) { return 0, nil },
@@ -28,6 +36,9 @@ func getline(out io.Writer, prompt string, defaultStr string, history readline.I
 	}
 	defer io.WriteString(out, _ANSI_CURSOR_OFF)
 	editor.BindKey(keys.Escape, readline.CmdInterrupt)
+	if complete != nil {
+		editor.BindKey(keys.CtrlI, complete)
+	}
 	text, err := editor.ReadLine(context.Background())
 	if err == readline.CtrlC {
 		return "", errors.New("Canceled")
@@ -36,7 +47,71 @@ func getline(out io.Writer, prompt string, defaultStr string, history readline.I
 }
 
 func yesNo(tty1 Tty, out io.Writer, message string) bool {
-	fmt.Fprintf(out, "%s\r%s%s", _ANSI_YELLOW, message, _ANSI_ERASE_LINE)
+	fmt.Fprintf(out, "%s\r%s%s", _STATUS_COLOR_ON, message, _ANSI_ERASE_LINE)
 	ch, err := tty1.GetKey()
 	return err == nil && ch == "y"
 }
+
+// pickOne shows items on the status line and returns the index of the one
+// selected by the cursor keys and ENTER, or -1 when canceled by ESCAPE.
+// Typing a letter moves to the next item starting with it.
+func pickOne(tty1 Tty, out io.Writer, prompt string, items []string, current int, width int) int {
+	first := 0
+	for {
+		if current < first {
+			first = current
+		}
+		avail := width - runewidth.StringWidth(prompt) - 1
+		for first < current {
+			w := 0
+			for _, s := range items[first : current+1] {
+				w += runewidth.StringWidth(s) + 1
+			}
+			if w <= avail {
+				break
+			}
+			first++
+		}
+		var line strings.Builder
+		line.WriteString(prompt)
+		w := 0
+		for i := first; i < len(items); i++ {
+			w += runewidth.StringWidth(items[i]) + 1
+			if w > avail {
+				break
+			}
+			line.WriteByte(' ')
+			if i == current {
+				line.WriteString(_CURSOR_COLOR_ON)
+				line.WriteString(items[i])
+				line.WriteString(_CURSOR_COLOR_OFF)
+			} else {
+				line.WriteString(items[i])
+			}
+		}
+		fmt.Fprintf(out, "\r%s%s%s%s", _STATUS_COLOR_ON, line.String(), _ANSI_ERASE_LINE, _ANSI_RESET)
+
+		key, err := tty1.GetKey()
+		if err != nil {
+			return -1
+		}
+		switch key {
+		case _KEY_ENTER, "\n":
+			return current
+		case _KEY_ESC, "q":
+			return -1
+		case _KEY_LEFT, _KEY_UP, "h", "k", _KEY_CTRL_B, _KEY_CTRL_P:
+			current = (current + len(items) - 1) % len(items)
+		case _KEY_RIGHT, _KEY_DOWN, "l", "j", _KEY_CTRL_F, _KEY_CTRL_N, _KEY_TAB, " ":
+			current = (current + 1) % len(items)
+		default:
+			for i := 1; i < len(items); i++ {
+				j := (current + i) % len(items)
+				if len(key) == 1 && strings.HasPrefix(strings.ToLower(items[j]), strings.ToLower(key)) {
+					current = j
+					break
+				}
+			}
+		}
+	}
+}
@@ -7,13 +7,13 @@ require (
 	github.com/mattn/go-runewidth v0.0.19
 	github.com/mattn/go-tty v0.0.7
 	github.com/nyaosorg/go-readline-ny v1.13.0
+	github.com/nyaosorg/go-ttyadapter v0.1.0
 	github.com/nyaosorg/go-windows-mbcs v0.4.4
 	golang.org/x/sys v0.30.0
+	golang.org/x/text v0.22.0
 )
 
 require (
 	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/nyaosorg/go-ttyadapter v0.1.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
 )
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// keyDisplayName returns the name of the key in the form which
+// parseKeyName accepts.
+func keyDisplayName(key string) string {
+	best := ""
+	for name, k := range keyNames {
+		if k == key && (best == "" || len(name) < len(best)) {
+			best = name
+		}
+	}
+	if best != "" {
+		return best
+	}
+	if len(key) == 1 && key[0] < 0x20 {
+		c := key[0] + '@'
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		return "C-" + string(c)
+	}
+	if len(key) == 2 && key[0] == '\x1B' {
+		return "M-" + key[1:]
+	}
+	return key
+}
+
+// keysOf returns the names of the keys bound to the command.
+func keysOf(name string) []string {
+	var keys []string
+	for key, n := range jumpTable {
+		if n == name {
+			keys = append(keys, keyDisplayName(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// helpLine is a line of the help screen.
+type helpLine struct {
+	text     string
+	category bool
+}
+
+// makeHelpLines lists the keys and the descriptions of all commands by
+// their categories. The commands without keys are shown as `:NAME`.
+func makeHelpLines() []helpLine {
+	type row struct{ keys, help string }
+	var rows [][]row
+	width := 0
+	for _, category := range categories {
+		var group []row
+		for _, c := range commands {
+			if c.category != category {
+				continue
+			}
+			keys := strings.Join(keysOf(c.name), " ")
+			if keys == "" {
+				keys = ":" + c.name
+			}
+			if w := runewidth.StringWidth(keys); w > width {
+				width = w
+			}
+			group = append(group, row{keys: keys, help: c.help})
+		}
+		rows = append(rows, group)
+	}
+	var lines []helpLine
+	for i, category := range categories {
+		lines = append(lines, helpLine{text: category, category: true})
+		for _, r := range rows[i] {
+			text := fmt.Sprintf("  %s%*s  %s",
+				r.keys, width-runewidth.StringWidth(r.keys), "", r.help)
+			lines = append(lines, helpLine{text: text})
+		}
+	}
+	return lines
+}
+
+const helpMessage = "help: j/k/SPACE/b to scroll, q to close"
+
+// helpView is the state of the help screen shown instead of the data.
+type helpView struct {
+	top int // the index of the first line shown
+}
+
+// Key processes all keys while the help screen is shown.
+func (hv *helpView) Key(app *Application, key string) {
+	page := app.dataHeight()
+	switch key {
+	case "q", _KEY_ESC, "?", _KEY_F1:
+		app.help = nil
+		return
+	case "j", _KEY_DOWN, _KEY_CTRL_N, _KEY_ENTER:
+		hv.top++
+	case "k", _KEY_UP, _KEY_CTRL_P:
+		hv.top--
+	case " ", _KEY_CTRL_F:
+		hv.top += page
+	case "b", _KEY_CTRL_B:
+		hv.top -= page
+	case "<":
+		hv.top = 0
+	case ">", "G":
+		hv.top = 1 << 30
+	}
+	app.message = helpMessage
+}
+
+// view draws the help screen as app.View draws the data.
+func (hv *helpView) view(app *Application) (int, error) {
+	h := app.dataHeight()
+	lines := makeHelpLines()
+	if hv.top > len(lines)-h {
+		hv.top = len(lines) - h
+	}
+	if hv.top < 0 {
+		hv.top = 0
+	}
+	count := 0
+	for i := hv.top; i < len(lines); i++ {
+		text := lines[i].text
+		if app.screenWidth > 0 {
+			text = runewidth.Truncate(text, app.screenWidth-1, "")
+		}
+		color := classColor(classPrintable, false)
+		if lines[i].category {
+			color = _CELL2_COLOR_ON
+		}
+		line := color + text + _ANSI_ERASE_LINE
+		if f := app.cache[count]; f != line {
+			io.WriteString(app.out, line)
+			app.cache[count] = line
+		}
+		if i+1 >= len(lines) || count+1 >= h {
+			break
+		}
+		count++
+		io.WriteString(app.out, "\r\n")
+	}
+	return count, nil
+}
+
+// keyFuncHelp shows the help screen.
+func keyFuncHelp(app *Application) error {
+	app.help = &helpView{}
+	app.message = helpMessage
+	return nil
+}
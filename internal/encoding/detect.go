@@ -0,0 +1,141 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bytesPointer is the Pointer on a byte slice.
+type bytesPointer struct {
+	data    []byte
+	address int64
+}
+
+func (p *bytesPointer) Value() byte    { return p.data[p.address] }
+func (p *bytesPointer) Address() int64 { return p.address }
+
+func (p *bytesPointer) Next() error {
+	if p.address+1 >= int64(len(p.data)) {
+		return io.EOF
+	}
+	p.address++
+	return nil
+}
+
+func (p *bytesPointer) Prev() error {
+	if p.address <= 0 {
+		return io.EOF
+	}
+	p.address--
+	return nil
+}
+
+// DetectBOM returns the encoding indicated by the byte order mark at the
+// top of head, or nil when head does not start with a BOM.
+func DetectBOM(head []byte) Encoding {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE, 0x00, 0x00}):
+		return UTF32LE()
+	case bytes.HasPrefix(head, []byte{0x00, 0x00, 0xFE, 0xFF}):
+		return UTF32BE()
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return UTF16LE()
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return UTF16BE()
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return UTF8Encoding{}
+	}
+	return nil
+}
+
+// zeroPattern returns UTF-16 or UTF-32 when the zero bytes in sample
+// appear at the positions where ASCII characters of them have zeros.
+// address is where sample starts in the data.
+func zeroPattern(sample []byte, address int64) Encoding {
+	var zeros [4]int
+	for i, b := range sample {
+		if b == 0 {
+			zeros[(address+int64(i))%4]++
+		}
+	}
+	quarter := len(sample) / 4
+	if quarter < 4 {
+		return nil
+	}
+	many := func(n int) bool { return n*10 >= quarter*8 }
+	few := func(n int) bool { return n*10 <= quarter }
+	switch {
+	case few(zeros[0]) && many(zeros[1]) && many(zeros[2]) && many(zeros[3]):
+		return UTF32LE()
+	case many(zeros[0]) && many(zeros[1]) && many(zeros[2]) && few(zeros[3]):
+		return UTF32BE()
+	case few(zeros[0]+zeros[2]) && many((zeros[1]+zeros[3])/2):
+		return UTF16LE()
+	case many((zeros[0]+zeros[2])/2) && few(zeros[1]+zeros[3]):
+		return UTF16BE()
+	}
+	return nil
+}
+
+// looksLikeText reports whether most characters of sample decoded with enc
+// are printable or the whitespaces of text. address is where sample starts
+// in the data and is used for the alignment of UTF-16/32.
+func looksLikeText(enc Encoding, sample []byte, address int64) bool {
+	// pad the head so that the index of the bytes is aligned as the address
+	pad := int(address % 4)
+	data := append(make([]byte, pad), sample...)
+	printable, total := 0, 0
+	for at := pad; at < len(data); {
+		r, n := DecodeAt(enc, &bytesPointer{data: data, address: int64(at)})
+		// an incomplete character at the end of sample is not counted
+		if r != utf8.RuneError || at+4 < len(data) {
+			total++
+			if unicode.IsPrint(r) || r == '\t' || r == '\n' || r == '\r' {
+				printable++
+			}
+		}
+		at += n
+	}
+	return printable*10 >= total*9
+}
+
+// score returns how likely sample is the text in enc: the number of bytes
+// decoded as printable non-ASCII characters minus the penalty for invalid
+// bytes and control characters.
+func score(enc Encoding, sample []byte) int {
+	result := 0
+	for at := int64(0); at < int64(len(sample)); {
+		r, n := DecodeAt(enc, &bytesPointer{data: sample, address: at})
+		// an incomplete character at the end of sample is not penalized
+		if r == utf8.RuneError && at+4 < int64(len(sample)) {
+			result -= 16
+		} else if r >= utf8.RuneSelf && unicode.IsPrint(r) {
+			result += n
+		} else if r < ' ' && r != '\t' && r != '\n' && r != '\r' {
+			result -= 4
+		}
+		at += int64(n)
+	}
+	return result
+}
+
+// Detect guesses the encoding of sample without BOM. address is where
+// sample starts in the data and is used for the alignment of UTF-16/32.
+// Data which looks like none of text is treated as UTF-8.
+func Detect(sample []byte, address int64) Encoding {
+	// the zeros of a table of small integers make the same pattern
+	if enc := zeroPattern(sample, address); enc != nil && looksLikeText(enc, sample, address) {
+		return enc
+	}
+	var best Encoding = UTF8Encoding{}
+	bestScore := 0
+	for _, enc := range []Encoding{UTF8Encoding{}, ShiftJIS(), EUCJP()} {
+		if s := score(enc, sample); s > bestScore {
+			best = enc
+			bestScore = s
+		}
+	}
+	return best
+}
@@ -2,6 +2,7 @@ package encoding
 
 import (
 	"errors"
+	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
 
@@ -94,8 +95,18 @@ func (DBCSEncoding) Decode(data []byte) rune {
 	return rune(utf16s[0])
 }
 
-func (DBCSEncoding) RuneOver(cursor Pointer) (rune, int, int) {
-	return utf8.RuneError, 1, 1
+// readChar reads the bytes of the character starting at p and leaves p
+// on the last byte of them.
+func (enc DBCSEncoding) readChar(p Pointer) []byte {
+	data := []byte{p.Value()}
+	if enc.Count(data[0], 0) == 2 && p.Next() == nil {
+		data = append(data, p.Value())
+	}
+	return data
+}
+
+func (enc DBCSEncoding) RuneOver(cursor Pointer) (rune, int, int) {
+	return runeOverBySync(cursor, enc.readChar, enc.Decode)
 }
 
 func (DBCSEncoding) ModeString() string {
@@ -122,19 +133,66 @@ func UTF16BE() Encoding {
 	return _UTF16{isLittleEndian: false}
 }
 
-func (_UTF16) Count(_ byte, address int64) int {
-	if address%2 == 0 {
-		return 2
-	} else {
+// Count returns 4 at a high surrogate of UTF-16BE. For UTF-16LE, the high
+// byte comes second, so a surrogate pair is found only by DecodeAt.
+func (this _UTF16) Count(value byte, address int64) int {
+	if address%2 != 0 {
 		return 1
 	}
+	if !this.isLittleEndian && 0xD8 <= value && value <= 0xDB {
+		return 4
+	}
+	return 2
 }
 
 func (this _UTF16) Decode(data []byte) rune {
+	if len(data) == 4 {
+		r1 := this.utf16ToRune(rune(data[0]), rune(data[1]))
+		r2 := this.utf16ToRune(rune(data[2]), rune(data[3]))
+		return utf16.DecodeRune(r1, r2) // RuneError unless a surrogate pair
+	}
 	if len(data) != 2 {
 		return utf8.RuneError
 	}
-	return this.utf16ToRune(rune(data[0]), rune(data[1]))
+	r := this.utf16ToRune(rune(data[0]), rune(data[1]))
+	if utf16.IsSurrogate(r) {
+		return utf8.RuneError
+	}
+	return r
+}
+
+// readUnit reads the 16-bit unit starting at p and leaves p on its
+// second byte.
+func (this _UTF16) readUnit(p Pointer) (rune, bool) {
+	first := rune(p.Value())
+	if p.Next() != nil {
+		return 0, false
+	}
+	return this.utf16ToRune(first, rune(p.Value())), true
+}
+
+func (this _UTF16) DecodeAt(p Pointer) (rune, int) {
+	if p.Address()%2 != 0 {
+		return utf8.RuneError, 1
+	}
+	r1, ok := this.readUnit(p)
+	if !ok {
+		return utf8.RuneError, 1
+	}
+	if !utf16.IsSurrogate(r1) {
+		return r1, 2
+	}
+	if p.Next() != nil {
+		return utf8.RuneError, 1
+	}
+	r2, ok := this.readUnit(p)
+	if !ok {
+		return utf8.RuneError, 1
+	}
+	if r := utf16.DecodeRune(r1, r2); r != utf8.RuneError {
+		return r, 4
+	}
+	return utf8.RuneError, 1
 }
 
 func (this _UTF16) EncodeFromString(s string) ([]byte, error) {
@@ -149,20 +207,34 @@ func (this _UTF16) EncodeFromString(s string) ([]byte, error) {
 	return bytes, nil
 }
 
+func isHighSurrogate(r rune) bool { return 0xD800 <= r && r < 0xDC00 }
+func isLowSurrogate(r rune) bool  { return 0xDC00 <= r && r < 0xE000 }
+
 func (this _UTF16) RuneOver(cursor Pointer) (rune, int, int) {
-	currentPosInRune := 0
-	theRune := rune(cursor.Value())
-	if cursor.Address()%2 != 0 { // the second byte
-		if cursor.Prev() != nil {
-			return utf8.RuneError, 0, 1
+	currentPosInRune := int(cursor.Address() % 2)
+	if currentPosInRune != 0 && cursor.Prev() != nil {
+		return utf8.RuneError, 0, 1
+	}
+	theRune, ok := this.readUnit(cursor)
+	if !ok {
+		return utf8.RuneError, 0, 1
+	}
+	if isHighSurrogate(theRune) {
+		if cursor.Next() == nil {
+			if low, ok := this.readUnit(cursor); ok && isLowSurrogate(low) {
+				return utf16.DecodeRune(theRune, low), currentPosInRune, 4
+			}
 		}
-		theRune = this.utf16ToRune(rune(cursor.Value()), theRune)
-		currentPosInRune++
-	} else { // the first byte
-		if cursor.Next() != nil {
-			return utf8.RuneError, 0, 1
+		return utf8.RuneError, 0, 1
+	}
+	if isLowSurrogate(theRune) {
+		// back to the high surrogate before
+		if cursor.Prev() == nil && cursor.Prev() == nil && cursor.Prev() == nil {
+			if high, ok := this.readUnit(cursor); ok && isHighSurrogate(high) {
+				return utf16.DecodeRune(high, theRune), currentPosInRune + 2, 4
+			}
 		}
-		theRune = this.utf16ToRune(theRune, rune(cursor.Value()))
+		return utf8.RuneError, 0, 1
 	}
 	return theRune, currentPosInRune, 2
 }
@@ -174,3 +246,82 @@ func (this _UTF16) ModeString() string {
 		return "16BE"
 	}
 }
+
+type _UTF32 struct {
+	isLittleEndian bool
+}
+
+func UTF32LE() Encoding {
+	return _UTF32{isLittleEndian: true}
+}
+
+func UTF32BE() Encoding {
+	return _UTF32{isLittleEndian: false}
+}
+
+func (_UTF32) Count(_ byte, address int64) int {
+	if address%4 == 0 {
+		return 4
+	} else {
+		return 1
+	}
+}
+
+func (this _UTF32) Decode(data []byte) rune {
+	if len(data) != 4 {
+		return utf8.RuneError
+	}
+	var value uint32
+	for i := range data {
+		if this.isLittleEndian {
+			value |= uint32(data[i]) << (8 * i)
+		} else {
+			value = value<<8 | uint32(data[i])
+		}
+	}
+	if value > unicode.MaxRune || utf16.IsSurrogate(rune(value)) {
+		return utf8.RuneError
+	}
+	return rune(value)
+}
+
+func (this _UTF32) EncodeFromString(s string) ([]byte, error) {
+	bytes := make([]byte, 0, len(s)*4)
+	for _, r := range s {
+		if this.isLittleEndian {
+			bytes = append(bytes, byte(r), byte(r>>8), byte(r>>16), byte(r>>24))
+		} else {
+			bytes = append(bytes, byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	return bytes, nil
+}
+
+func (this _UTF32) RuneOver(cursor Pointer) (rune, int, int) {
+	currentPosInRune := int(cursor.Address() % 4)
+	for i := 0; i < currentPosInRune; i++ {
+		if cursor.Prev() != nil {
+			return utf8.RuneError, 0, 1
+		}
+	}
+	var data [4]byte
+	for i := range data {
+		if i > 0 && cursor.Next() != nil {
+			return utf8.RuneError, 0, 1
+		}
+		data[i] = cursor.Value()
+	}
+	theRune := this.Decode(data[:])
+	if theRune == utf8.RuneError {
+		return utf8.RuneError, 0, 1
+	}
+	return theRune, currentPosInRune, 4
+}
+
+func (this _UTF32) ModeString() string {
+	if this.isLittleEndian {
+		return "32LE"
+	} else {
+		return "32BE"
+	}
+}
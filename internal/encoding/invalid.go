@@ -0,0 +1,119 @@
+package encoding
+
+import (
+	"unicode/utf8"
+)
+
+// Invalid is the kind of the error of a byte sequence.
+type Invalid int
+
+const (
+	Valid             Invalid = iota
+	InvalidByte               // can not be decoded with the encoding
+	StrayContinuation         // UTF-8 continuation byte without a leading byte
+	Overlong                  // UTF-8 longer than needed for the code point
+	Surrogate                 // UTF-8 encoding U+D800-U+DFFF
+	OutOfRange                // UTF-8 encoding beyond U+10FFFF
+	Truncated                 // a leading byte without enough following bytes
+)
+
+func (e Invalid) String() string {
+	switch e {
+	case Valid:
+		return "valid"
+	case InvalidByte:
+		return "invalid byte"
+	case StrayContinuation:
+		return "stray continuation byte"
+	case Overlong:
+		return "overlong encoding"
+	case Surrogate:
+		return "encoded surrogate"
+	case OutOfRange:
+		return "out of Unicode range"
+	case Truncated:
+		return "truncated sequence"
+	}
+	return "unknown"
+}
+
+// Validator is implemented by the encodings which can tell why the bytes
+// can not be decoded.
+type Validator interface {
+	// Validate checks the bytes starting at the pointer and returns the
+	// kind of the error and how many bytes it covers. The pointer may
+	// be moved.
+	Validate(Pointer) (Invalid, int)
+}
+
+// Validate checks the bytes starting at the pointer with the encoding and
+// returns the kind of the error and how many bytes it covers. The pointer
+// may be moved.
+func Validate(enc Encoding, p Pointer) (Invalid, int) {
+	if v, ok := enc.(Validator); ok {
+		return v.Validate(p)
+	}
+	r, length := DecodeAt(enc, p)
+	if r == utf8.RuneError {
+		return InvalidByte, 1
+	}
+	return Valid, length
+}
+
+func isContinuation(b byte) bool {
+	return b&0xC0 == 0x80
+}
+
+func (UTF8Encoding) Validate(p Pointer) (Invalid, int) {
+	first := p.Value()
+	var length int
+	var codePoint rune
+	switch {
+	case first < 0x80:
+		return Valid, 1
+	case isContinuation(first):
+		return StrayContinuation, 1
+	case first < 0xE0:
+		length, codePoint = 2, rune(first&0x1F)
+	case first < 0xF0:
+		length, codePoint = 3, rune(first&0x0F)
+	case first < 0xF8:
+		length, codePoint = 4, rune(first&0x07)
+	default:
+		return InvalidByte, 1
+	}
+	for i := 1; i < length; i++ {
+		if p.Next() != nil || !isContinuation(p.Value()) {
+			return Truncated, i
+		}
+		codePoint = codePoint<<6 | rune(p.Value()&0x3F)
+	}
+	switch {
+	case codePoint < 0x80 || codePoint < 0x800 && length > 2 || codePoint < 0x10000 && length > 3:
+		return Overlong, length
+	case 0xD800 <= codePoint && codePoint <= 0xDFFF:
+		return Surrogate, length
+	case codePoint > utf8.MaxRune:
+		return OutOfRange, length
+	}
+	return Valid, length
+}
+
+// Validate accepts the escape sequences as valid.
+func (_ISO2022JP) Validate(p Pointer) (Invalid, int) {
+	target := p.Address()
+	data, state, start := unitAt(p)
+	if start != target {
+		return InvalidByte, 1
+	}
+	if data[0] == 0x1B {
+		if len(data) > 1 {
+			return Valid, len(data)
+		}
+		return InvalidByte, 1
+	}
+	if decodeUnit(data, state) == utf8.RuneError {
+		return InvalidByte, 1
+	}
+	return Valid, len(data)
+}
@@ -0,0 +1,159 @@
+package encoding
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+const (
+	jisASCII = iota
+	jisKatakana
+	jisX0208
+	jisX0212
+)
+
+// escape sequences to start each state
+var jisEscape = [...][]byte{
+	jisASCII:    {0x1B, '(', 'B'},
+	jisKatakana: {0x1B, '(', 'I'},
+	jisX0208:    {0x1B, '$', 'B'},
+	jisX0212:    {0x1B, '$', '(', 'D'},
+}
+
+// _ISO2022JP is the stateful 7-bit encoding. The state of a byte is found
+// by scanning back to the last escape sequence or line feed, both of which
+// never appear inside a character.
+type _ISO2022JP struct{}
+
+func ISO2022JP() Encoding {
+	return _ISO2022JP{}
+}
+
+func (_ISO2022JP) Count(value byte, _ int64) int {
+	return 1
+}
+
+// Decode decodes data assuming it starts in the ASCII state. data may
+// start with an escape sequence.
+func (_ISO2022JP) Decode(data []byte) rune {
+	return decodeOne(japanese.ISO2022JP, data)
+}
+
+func (_ISO2022JP) EncodeFromString(s string) ([]byte, error) {
+	return japanese.ISO2022JP.NewEncoder().Bytes([]byte(s))
+}
+
+func (_ISO2022JP) ModeString() string {
+	return "JIS"
+}
+
+// readEscape reads the escape sequence starting at p and returns the new
+// state and its bytes. p is left on the last byte of it. For an unknown
+// sequence, it returns -1 and p stays.
+func readEscape(p Pointer) (int, []byte) {
+	data := []byte{p.Value()}
+	for len(data) < 4 && p.Next() == nil {
+		data = append(data, p.Value())
+		for state, esc := range jisEscape {
+			if string(esc) == string(data) {
+				return state, data
+			}
+		}
+		switch string(data) {
+		case "\x1B(J": // JIS X 0201 Roman
+			return jisASCII, data
+		case "\x1B$@": // JIS C 6226
+			return jisX0208, data
+		}
+	}
+	for i := 1; i < len(data); i++ {
+		p.Prev()
+	}
+	return -1, data[:1]
+}
+
+// readUnit reads a character or an escape sequence starting at p in the
+// state and returns its bytes and the state after it. p is left on the
+// last byte of the unit.
+func readUnit(p Pointer, state int) ([]byte, int) {
+	c := p.Value()
+	if c == 0x1B {
+		newState, data := readEscape(p)
+		if newState < 0 {
+			return data, state
+		}
+		return data, newState
+	}
+	if c == '\n' {
+		return []byte{c}, jisASCII
+	}
+	if (state == jisX0208 || state == jisX0212) && 0x21 <= c && c <= 0x7E {
+		if p.Next() == nil {
+			if c2 := p.Value(); 0x21 <= c2 && c2 <= 0x7E {
+				return []byte{c, c2}, state
+			}
+			p.Prev()
+		}
+	}
+	return []byte{c}, state
+}
+
+// decodeUnit decodes the unit read by readUnit in the state.
+func decodeUnit(data []byte, state int) rune {
+	if len(data) <= 0 || data[0] == 0x1B || data[0] >= utf8.RuneSelf {
+		return utf8.RuneError
+	}
+	src := append(append([]byte{}, jisEscape[state]...), data...)
+	return decodeOne(japanese.ISO2022JP, src)
+}
+
+// unitAt finds the unit which contains the byte at p. It returns the unit,
+// the state for it and the address where it starts. p is left on the last
+// byte of the unit.
+func unitAt(p Pointer) ([]byte, int, int64) {
+	target := p.Address()
+	for i := 0; i < scanLimit; i++ {
+		if c := p.Value(); c == 0x1B || c == '\n' {
+			break
+		}
+		if p.Prev() != nil {
+			break
+		}
+	}
+	state := jisASCII
+	for {
+		start := p.Address()
+		data, newState := readUnit(p, state)
+		if target < start+int64(len(data)) {
+			return data, state, start
+		}
+		state = newState
+		if p.Next() != nil {
+			return data, state, start
+		}
+	}
+}
+
+func (_ISO2022JP) DecodeAt(p Pointer) (rune, int) {
+	target := p.Address()
+	data, state, start := unitAt(p)
+	if start != target {
+		return utf8.RuneError, 1
+	}
+	r := decodeUnit(data, state)
+	if r == utf8.RuneError {
+		return utf8.RuneError, 1
+	}
+	return r, len(data)
+}
+
+func (_ISO2022JP) RuneOver(cursor Pointer) (rune, int, int) {
+	target := cursor.Address()
+	data, state, start := unitAt(cursor)
+	r := decodeUnit(data, state)
+	if r == utf8.RuneError || target < start {
+		return utf8.RuneError, 0, 1
+	}
+	return r, int(target - start), len(data)
+}
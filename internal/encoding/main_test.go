@@ -3,13 +3,17 @@ package encoding
 import (
 	"errors"
 	"runtime"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 var _ Encoding = UTF8Encoding{}
 var _ Encoding = DBCSEncoding{}
 var _ Encoding = UTF16LE()
 var _ Encoding = UTF16BE()
+var _ Encoding = UTF32LE()
+var _ Encoding = UTF32BE()
 
 func TestIsDBCSLeadByte(t *testing.T) {
 	if runtime.GOOS == "windows" && !IsDBCSLeadByte(0x83) { // Japanese katakana SO
@@ -39,3 +43,262 @@ func TestToWideChar(t *testing.T) {
 		return
 	}
 }
+
+var _ Encoding = ShiftJIS()
+var _ Encoding = EUCJP()
+var _ Encoding = ISO2022JP()
+var _ Encoding = GBK()
+var _ Encoding = GB18030()
+var _ Encoding = Big5()
+var _ Encoding = EUCKR()
+
+// decodeAll decodes data as makeAsciiPart does
+func decodeAll(enc Encoding, data []byte) []rune {
+	var result []rune
+	for at := int64(0); at < int64(len(data)); {
+		r, n := DecodeAt(enc, &bytesPointer{data: data, address: at})
+		result = append(result, r)
+		at += int64(n)
+	}
+	return result
+}
+
+func TestMultiByteEncodings(t *testing.T) {
+	const text = "aあ漢字b"
+	for _, name := range []string{"Shift_JIS", "EUC-JP", "ISO-2022-JP", "GBK", "GB18030", "Big5", "EUC-KR"} {
+		enc, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("%s: not found", name)
+		}
+		source := text
+		if name == "Big5" {
+			source = "a漢字b" // Big5 does not have Hiragana
+		}
+		data, err := enc.EncodeFromString(source)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		var decoded []rune
+		for _, r := range decodeAll(enc, data) {
+			if r != utf8.RuneError { // escape sequences of ISO-2022-JP
+				decoded = append(decoded, r)
+			}
+		}
+		if string(decoded) != source {
+			t.Fatalf("%s: expect %q but %q", name, source, string(decoded))
+		}
+		for i := range data {
+			theRune, pos, length := enc.RuneOver(&bytesPointer{data: data, address: int64(i)})
+			if theRune == utf8.RuneError {
+				continue
+			}
+			if pos >= length || strings.IndexRune(source, theRune) < 0 {
+				t.Fatalf("%s: RuneOver(%d)=(%q,%d,%d)", name, i, theRune, pos, length)
+			}
+		}
+	}
+}
+
+func TestShiftJISRuneOver(t *testing.T) {
+	// "ソ" is 0x83 0x5C, whose second byte is also a backslash
+	data := []byte{'a', 0x83, 0x5C, 0x83, 0x5C, 'b'}
+	expect := []struct {
+		theRune rune
+		pos     int
+		length  int
+	}{
+		{'a', 0, 1}, {'ソ', 0, 2}, {'ソ', 1, 2}, {'ソ', 0, 2}, {'ソ', 1, 2}, {'b', 0, 1},
+	}
+	for i, e := range expect {
+		theRune, pos, length := ShiftJIS().RuneOver(&bytesPointer{data: data, address: int64(i)})
+		if theRune != e.theRune || pos != e.pos || length != e.length {
+			t.Fatalf("RuneOver(%d)=(%q,%d,%d)", i, theRune, pos, length)
+		}
+	}
+}
+
+func TestGB18030FourBytes(t *testing.T) {
+	data, err := GB18030().EncodeFromString("a😀b")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if runes := decodeAll(GB18030(), data); string(runes) != "a😀b" {
+		t.Fatalf("expect %q but %q", "a😀b", string(runes))
+	}
+}
+
+func TestISO2022JPState(t *testing.T) {
+	data := []byte("\x1B$B$\"\x1B(B$\"")
+	runes := decodeAll(ISO2022JP(), data)
+	expect := []rune{utf8.RuneError, utf8.RuneError, utf8.RuneError, 'あ', utf8.RuneError, utf8.RuneError, utf8.RuneError, '$', '"'}
+	if string(runes) != string(expect) {
+		t.Fatalf("expect %q but %q", string(expect), string(runes))
+	}
+	theRune, pos, length := ISO2022JP().RuneOver(&bytesPointer{data: data, address: 4})
+	if theRune != 'あ' || pos != 1 || length != 2 {
+		t.Fatalf("RuneOver(4)=(%q,%d,%d)", theRune, pos, length)
+	}
+}
+
+func TestUTF16SurrogatePair(t *testing.T) {
+	for _, enc := range []Encoding{UTF16LE(), UTF16BE()} {
+		data, _ := enc.EncodeFromString("a😀b")
+		if runes := decodeAll(enc, data); string(runes) != "a😀b" {
+			t.Fatalf("%s: expect %q but %q", enc.ModeString(), "a😀b", string(runes))
+		}
+		for i := 2; i < 6; i++ {
+			theRune, pos, length := enc.RuneOver(&bytesPointer{data: data, address: int64(i)})
+			if theRune != '😀' || pos != i-2 || length != 4 {
+				t.Fatalf("%s: RuneOver(%d)=(%q,%d,%d)", enc.ModeString(), i, theRune, pos, length)
+			}
+		}
+		// a lone surrogate is invalid
+		lone := data[:4]
+		if runes := decodeAll(enc, lone); runes[1] != utf8.RuneError {
+			t.Fatalf("%s: lone surrogate is decoded as %q", enc.ModeString(), runes[1])
+		}
+		if theRune, _, _ := enc.RuneOver(&bytesPointer{data: lone, address: 2}); theRune != utf8.RuneError {
+			t.Fatalf("%s: RuneOver of lone surrogate is %q", enc.ModeString(), theRune)
+		}
+	}
+}
+
+func TestUTF32(t *testing.T) {
+	for _, enc := range []Encoding{UTF32LE(), UTF32BE()} {
+		data, _ := enc.EncodeFromString("a😀")
+		if len(data) != 8 {
+			t.Fatalf("%s: len(data)==%d", enc.ModeString(), len(data))
+		}
+		if runes := decodeAll(enc, data); string(runes) != "a😀" {
+			t.Fatalf("%s: expect %q but %q", enc.ModeString(), "a😀", string(runes))
+		}
+		theRune, pos, length := enc.RuneOver(&bytesPointer{data: data, address: 6})
+		if theRune != '😀' || pos != 2 || length != 4 {
+			t.Fatalf("%s: RuneOver(6)=(%q,%d,%d)", enc.ModeString(), theRune, pos, length)
+		}
+	}
+	if r := UTF32LE().Decode([]byte{0, 0, 0x11, 0}); r != utf8.RuneError {
+		t.Fatalf("U+110000 is decoded as %q", r)
+	}
+}
+
+func TestSingleByteEncodings(t *testing.T) {
+	for _, name := range Names() {
+		enc, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("%s: not found", name)
+		}
+		if _, ok := Lookup(enc.ModeString()); !ok {
+			t.Fatalf("%s: ModeString %s is not found", name, enc.ModeString())
+		}
+	}
+	tests := []struct {
+		name   string
+		data   []byte
+		expect string
+	}{
+		{"ISO-8859-1", []byte{0x41, 0xE9}, "Aé"},
+		{"Windows-1252", []byte{0x80, 0x93}, "€“"},
+		{"CP437", []byte{0xC9, 0xCD, 0xBB}, "╔═╗"},
+		{"KOI8-R", []byte{0xF2, 0xD5}, "Ру"},
+		{"CP037", []byte{0xC1, 0x4A, 0x5A}, "A¢!"},
+		{"CP500", []byte{0xC1, 0x4A, 0x5A}, "A[]"},
+	}
+	for _, tt := range tests {
+		enc, _ := Lookup(tt.name)
+		if runes := decodeAll(enc, tt.data); string(runes) != tt.expect {
+			t.Fatalf("%s: expect %q but %q", tt.name, tt.expect, string(runes))
+		}
+		data, err := enc.EncodeFromString(tt.expect)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		if string(data) != string(tt.data) {
+			t.Fatalf("%s: expect % X but % X", tt.name, tt.data, data)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	const text = "日本語のテキストです。\r\nこれは漢字とかなを含む文章です。\r\n"
+	encode := func(name string) []byte {
+		enc, _ := Lookup(name)
+		data, err := enc.EncodeFromString(text)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return data
+	}
+	tests := []struct {
+		data   []byte
+		expect string
+	}{
+		{encode("UTF-8"), "UTF8"},
+		{encode("Shift_JIS"), "SJIS"},
+		{encode("EUC-JP"), "EUCJP"},
+		{[]byte("a\x00b\x00c\x00d\x00e\x00f\x00g\x00h\x00"), "16LE"},
+		{[]byte("\x00a\x00b\x00c\x00d\x00e\x00f\x00g\x00h"), "16BE"},
+		{[]byte("a\x00\x00\x00b\x00\x00\x00c\x00\x00\x00d\x00\x00\x00e\x00\x00\x00"), "32LE"},
+		{[]byte("\x00\x00\x00a\x00\x00\x00b\x00\x00\x00c\x00\x00\x00d\x00\x00\x00e"), "32BE"},
+		{[]byte("\x7FELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x3E\x00\x01\x00\x00\x00\x90\xF3\x82\xA5\x00\x00"), "UTF8"},
+	}
+	for _, tt := range tests {
+		if enc := Detect(tt.data, 0); enc.ModeString() != tt.expect {
+			t.Fatalf("%q: expect %s but %s", tt.data, tt.expect, enc.ModeString())
+		}
+	}
+	// the alignment depends on the address
+	if enc := Detect([]byte("\x00a\x00b\x00c\x00d\x00e\x00f\x00g\x00h"), 1); enc.ModeString() != "16LE" {
+		t.Fatalf("expect 16LE but %s", enc.ModeString())
+	}
+	// the tables of small integers are not text
+	var table16, table32 []byte
+	for i := 1; i <= 64; i++ {
+		table16 = append(table16, byte(i), 0)
+		table32 = append(table32, byte(i), 0, 0, 0)
+	}
+	for _, table := range [][]byte{table16, table32} {
+		if enc := Detect(table, 0); enc.ModeString() != "UTF8" {
+			t.Fatalf("%q: expect UTF8 but %s", table, enc.ModeString())
+		}
+	}
+	if enc := DetectBOM([]byte{0xEF, 0xBB, 0xBF, 'a'}); enc == nil || enc.ModeString() != "UTF8" {
+		t.Fatal("UTF-8 BOM is not detected")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		data   string
+		kind   Invalid
+		length int
+	}{
+		{"a", Valid, 1},
+		{"\xE3\x81\x82", Valid, 3},
+		{"\xEF\xBF\xBD", Valid, 3},
+		{"\x80", StrayContinuation, 1},
+		{"\xC0\xAF", Overlong, 2},
+		{"\xE0\x80\xAF", Overlong, 3},
+		{"\xF0\x8D\xA0\x80", Overlong, 4},
+		{"\xED\xA0\x80", Surrogate, 3},
+		{"\xF4\x90\x80\x80", OutOfRange, 4},
+		{"\xF5\x80\x80\x80", OutOfRange, 4},
+		{"\xE3\x81a", Truncated, 2},
+		{"\xE3", Truncated, 1},
+		{"\xFF", InvalidByte, 1},
+	}
+	for _, tt := range tests {
+		kind, length := Validate(UTF8Encoding{}, &bytesPointer{data: []byte(tt.data)})
+		if kind != tt.kind || length != tt.length {
+			t.Fatalf("%q: expect %s/%d but %s/%d", tt.data, tt.kind, tt.length, kind, length)
+		}
+	}
+
+	// escape sequences are not invalid
+	if kind, length := Validate(ISO2022JP(), &bytesPointer{data: []byte("\x1B$B$\"")}); kind != Valid || length != 3 {
+		t.Fatalf("escape sequence: %s/%d", kind, length)
+	}
+	if kind, _ := Validate(ShiftJIS(), &bytesPointer{data: []byte("\xA0")}); kind != InvalidByte {
+		t.Fatalf("SJIS 0xA0: %s", kind)
+	}
+}
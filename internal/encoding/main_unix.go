@@ -3,6 +3,14 @@
 
 package encoding
 
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
 func IsDBCSLeadByte(b byte) bool {
 	return false
 }
@@ -10,3 +18,61 @@ func IsDBCSLeadByte(b byte) bool {
 func ToWideChar(bytes ...byte) ([]uint16, error) {
 	return []uint16{}, ErrNotSupport
 }
+
+// ansiByLanguage is the encoding used for the language when the locale
+// does not tell the charset or it is UTF-8.
+var ansiByLanguage = map[string]func() Encoding{
+	"ja":    ShiftJIS,
+	"zh_CN": GBK,
+	"zh_SG": GBK,
+	"zh_TW": Big5,
+	"zh_HK": Big5,
+	"ko":    EUCKR,
+	"th":    singleByte("CP874", charmap.Windows874),
+	"el":    singleByte("CP1253", charmap.Windows1253),
+	"tr":    singleByte("CP1254", charmap.Windows1254),
+	"he":    singleByte("CP1255", charmap.Windows1255),
+	"ar":    singleByte("CP1256", charmap.Windows1256),
+	"fa":    singleByte("CP1256", charmap.Windows1256),
+	"vi":    singleByte("CP1258", charmap.Windows1258),
+}
+
+func init() {
+	for _, lang := range []string{"cs", "hr", "hu", "pl", "ro", "sk", "sl", "sq"} {
+		ansiByLanguage[lang] = singleByte("CP1250", charmap.Windows1250)
+	}
+	for _, lang := range []string{"be", "bg", "mk", "ru", "uk"} {
+		ansiByLanguage[lang] = singleByte("CP1251", charmap.Windows1251)
+	}
+	for _, lang := range []string{"ca", "da", "de", "en", "es", "eu", "fi", "fr", "gl", "id", "is", "it", "nb", "nl", "nn", "no", "pt", "sv"} {
+		ansiByLanguage[lang] = singleByte("CP1252", charmap.Windows1252)
+	}
+	for _, lang := range []string{"et", "lt", "lv"} {
+		ansiByLanguage[lang] = singleByte("CP1257", charmap.Windows1257)
+	}
+}
+
+// ANSI returns the legacy encoding for the locale (LC_ALL, LC_CTYPE or
+// LANG) as the substitute of the Windows ANSI code page.
+func ANSI() (Encoding, error) {
+	var locale string
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale = os.Getenv(name); locale != "" {
+			break
+		}
+	}
+	if i := strings.IndexByte(locale, '@'); i >= 0 {
+		locale = locale[:i]
+	}
+	lang, charset, _ := strings.Cut(locale, ".")
+	if enc, ok := Lookup(charset); ok && normalizeName(charset) != "utf8" {
+		return enc, nil
+	}
+	if f, ok := ansiByLanguage[lang]; ok {
+		return f(), nil
+	}
+	if language, _, _ := strings.Cut(lang, "_"); ansiByLanguage[language] != nil {
+		return ansiByLanguage[language](), nil
+	}
+	return nil, errors.New("ANSI encoding is unknown for the locale. Select the encoding by ALT-E")
+}
@@ -25,3 +25,8 @@ func ToWideChar(bytes ...byte) ([]uint16, error) {
 
 	return wideBuffer[:nwrite], err
 }
+
+// ANSI returns the encoding of the current Windows code page.
+func ANSI() (Encoding, error) {
+	return DBCSEncoding{}, nil
+}
@@ -0,0 +1,201 @@
+package encoding
+
+import (
+	"unicode/utf8"
+
+	xencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// scanLimit is how many bytes RuneOver looks back for the boundary of
+// characters in the encodings which are not self-synchronizing.
+const scanLimit = 1024
+
+// PointerDecoder is implemented by the encodings whose length of a
+// character can not be decided by its first byte only.
+type PointerDecoder interface {
+	// DecodeAt decodes the character starting at the pointer and returns
+	// it and its length. The pointer may be moved.
+	DecodeAt(Pointer) (rune, int)
+}
+
+// DecodeAt decodes the character starting at the pointer with the encoding
+// and returns it and its length. For invalid bytes, it returns
+// utf8.RuneError and 1. The pointer may be moved.
+func DecodeAt(enc Encoding, p Pointer) (rune, int) {
+	if d, ok := enc.(PointerDecoder); ok {
+		return d.DecodeAt(p)
+	}
+	var runeBuffer [utf8.UTFMax]byte
+	length := enc.Count(p.Value(), p.Address())
+	runeBuffer[0] = p.Value()
+	readCount := 1
+	for readCount < length && readCount < len(runeBuffer) && p.Next() == nil {
+		runeBuffer[readCount] = p.Value()
+		readCount++
+	}
+	c := enc.Decode(runeBuffer[:readCount])
+	if c == utf8.RuneError {
+		return utf8.RuneError, 1
+	}
+	return c, length
+}
+
+// _MultiByte is the legacy multi-byte encoding whose tables are provided
+// by golang.org/x/text. Any byte less than 0x30 is a single-byte character
+// in all of them, so RuneOver scans back to such a byte to find where the
+// character under the cursor starts.
+type _MultiByte struct {
+	name   string
+	codec  xencoding.Encoding
+	length func(first, second byte) int
+}
+
+func sjisLength(first, _ byte) int {
+	if 0x81 <= first && first <= 0x9F || 0xE0 <= first && first <= 0xFC {
+		return 2
+	}
+	return 1
+}
+
+func eucJPLength(first, _ byte) int {
+	if first == 0x8F { // JIS X 0212
+		return 3
+	}
+	if first == 0x8E || 0xA1 <= first && first <= 0xFE {
+		return 2
+	}
+	return 1
+}
+
+func dbcsLength(first, _ byte) int {
+	if 0x81 <= first && first <= 0xFE {
+		return 2
+	}
+	return 1
+}
+
+func gb18030Length(first, second byte) int {
+	if 0x81 <= first && first <= 0xFE {
+		if 0x30 <= second && second <= 0x39 {
+			return 4
+		}
+		return 2
+	}
+	return 1
+}
+
+func ShiftJIS() Encoding {
+	return _MultiByte{name: "SJIS", codec: japanese.ShiftJIS, length: sjisLength}
+}
+
+func EUCJP() Encoding {
+	return _MultiByte{name: "EUCJP", codec: japanese.EUCJP, length: eucJPLength}
+}
+
+func GBK() Encoding {
+	return _MultiByte{name: "GBK", codec: simplifiedchinese.GBK, length: dbcsLength}
+}
+
+func GB18030() Encoding {
+	return _MultiByte{name: "GB18030", codec: simplifiedchinese.GB18030, length: gb18030Length}
+}
+
+func Big5() Encoding {
+	return _MultiByte{name: "BIG5", codec: traditionalchinese.Big5, length: dbcsLength}
+}
+
+// EUCKR returns EUC-KR extended as the Unified Hangul Code (CP949).
+func EUCKR() Encoding {
+	return _MultiByte{name: "EUCKR", codec: korean.EUCKR, length: dbcsLength}
+}
+
+// Count returns the length guessed from the first byte. It may be
+// shorter than the actual one for 4-byte sequences of GB18030.
+func (m _MultiByte) Count(value byte, _ int64) int {
+	return m.length(value, 0)
+}
+
+func (m _MultiByte) Decode(data []byte) rune {
+	return decodeOne(m.codec, data)
+}
+
+// decodeOne returns the rune when data is exactly one character.
+func decodeOne(codec xencoding.Encoding, data []byte) rune {
+	s, err := codec.NewDecoder().Bytes(data)
+	if err != nil {
+		return utf8.RuneError
+	}
+	r, size := utf8.DecodeRune(s)
+	if size != len(s) {
+		return utf8.RuneError
+	}
+	return r
+}
+
+func (m _MultiByte) EncodeFromString(s string) ([]byte, error) {
+	return m.codec.NewEncoder().Bytes([]byte(s))
+}
+
+func (m _MultiByte) ModeString() string {
+	return m.name
+}
+
+// readChar reads the bytes of the character starting at p and leaves p
+// on the last byte of them.
+func (m _MultiByte) readChar(p Pointer) []byte {
+	data := []byte{p.Value()}
+	n := m.length(data[0], 0)
+	for len(data) < n && p.Next() == nil {
+		data = append(data, p.Value())
+		if len(data) == 2 {
+			n = m.length(data[0], data[1])
+		}
+	}
+	return data
+}
+
+func (m _MultiByte) DecodeAt(p Pointer) (rune, int) {
+	data := m.readChar(p)
+	if r := m.Decode(data); r != utf8.RuneError {
+		return r, len(data)
+	}
+	return utf8.RuneError, 1
+}
+
+func (m _MultiByte) RuneOver(cursor Pointer) (rune, int, int) {
+	return runeOverBySync(cursor, m.readChar, m.Decode)
+}
+
+// runeOverBySync finds the character under the cursor by scanning back to
+// a byte less than 0x30, which is never a part of a multi-byte character,
+// and reading characters from there with readChar.
+func runeOverBySync(cursor Pointer, readChar func(Pointer) []byte, decode func([]byte) rune) (rune, int, int) {
+	target := cursor.Address()
+	for i := 0; i < scanLimit && cursor.Value() >= 0x30 && cursor.Prev() == nil; i++ {
+	}
+	for {
+		start := cursor.Address()
+		data := readChar(cursor)
+		theRune := decode(data)
+		if theRune == utf8.RuneError {
+			// an invalid byte is shown as one character
+			for i := 1; i < len(data); i++ {
+				cursor.Prev()
+			}
+			data = data[:1]
+		}
+		if target < start+int64(len(data)) {
+			if theRune == utf8.RuneError || target < start {
+				return utf8.RuneError, 0, 1
+			}
+			return theRune, int(target - start), len(data)
+		}
+		if cursor.Next() != nil {
+			return utf8.RuneError, 0, 1
+		}
+	}
+}
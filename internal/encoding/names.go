@@ -0,0 +1,103 @@
+package encoding
+
+import (
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+type registryEntry struct {
+	name    string
+	aliases []string
+	New     func() Encoding
+}
+
+func singleByte(name string, cm *charmap.Charmap) func() Encoding {
+	return func() Encoding { return newSingleByte(name, cm, nil) }
+}
+
+// registry is the list of encodings selectable by name in the order shown
+// by the picker.
+var registry = []registryEntry{
+	{"UTF-8", []string{"UTF8"}, func() Encoding { return UTF8Encoding{} }},
+	{"UTF-16LE", []string{"16LE"}, UTF16LE},
+	{"UTF-16BE", []string{"16BE"}, UTF16BE},
+	{"UTF-32LE", []string{"32LE", "UCS-4LE"}, UTF32LE},
+	{"UTF-32BE", []string{"32BE", "UCS-4BE"}, UTF32BE},
+	{"Shift_JIS", []string{"SJIS", "CP932", "MS932", "Windows-31J"}, ShiftJIS},
+	{"EUC-JP", []string{"EUCJP"}, EUCJP},
+	{"ISO-2022-JP", []string{"JIS"}, ISO2022JP},
+	{"GBK", []string{"CP936", "GB2312"}, GBK},
+	{"GB18030", nil, GB18030},
+	{"Big5", []string{"CP950"}, Big5},
+	{"EUC-KR", []string{"EUCKR", "CP949", "UHC"}, EUCKR},
+	{"ISO-8859-1", []string{"8859-1", "Latin1"}, singleByte("8859-1", charmap.ISO8859_1)},
+	{"ISO-8859-2", []string{"8859-2", "Latin2"}, singleByte("8859-2", charmap.ISO8859_2)},
+	{"ISO-8859-3", []string{"8859-3", "Latin3"}, singleByte("8859-3", charmap.ISO8859_3)},
+	{"ISO-8859-4", []string{"8859-4", "Latin4"}, singleByte("8859-4", charmap.ISO8859_4)},
+	{"ISO-8859-5", []string{"8859-5"}, singleByte("8859-5", charmap.ISO8859_5)},
+	{"ISO-8859-6", []string{"8859-6"}, singleByte("8859-6", charmap.ISO8859_6)},
+	{"ISO-8859-7", []string{"8859-7"}, singleByte("8859-7", charmap.ISO8859_7)},
+	{"ISO-8859-8", []string{"8859-8"}, singleByte("8859-8", charmap.ISO8859_8)},
+	{"ISO-8859-9", []string{"8859-9", "Latin5"}, singleByte("8859-9", charmap.ISO8859_9)},
+	{"ISO-8859-10", []string{"8859-10", "Latin6"}, singleByte("8859-10", charmap.ISO8859_10)},
+	{"ISO-8859-13", []string{"8859-13", "Latin7"}, singleByte("8859-13", charmap.ISO8859_13)},
+	{"ISO-8859-14", []string{"8859-14", "Latin8"}, singleByte("8859-14", charmap.ISO8859_14)},
+	{"ISO-8859-15", []string{"8859-15", "Latin9"}, singleByte("8859-15", charmap.ISO8859_15)},
+	{"ISO-8859-16", []string{"8859-16", "Latin10"}, singleByte("8859-16", charmap.ISO8859_16)},
+	{"Windows-874", []string{"CP874", "TIS-620"}, singleByte("CP874", charmap.Windows874)},
+	{"Windows-1250", []string{"CP1250"}, singleByte("CP1250", charmap.Windows1250)},
+	{"Windows-1251", []string{"CP1251"}, singleByte("CP1251", charmap.Windows1251)},
+	{"Windows-1252", []string{"CP1252"}, singleByte("CP1252", charmap.Windows1252)},
+	{"Windows-1253", []string{"CP1253"}, singleByte("CP1253", charmap.Windows1253)},
+	{"Windows-1254", []string{"CP1254"}, singleByte("CP1254", charmap.Windows1254)},
+	{"Windows-1255", []string{"CP1255"}, singleByte("CP1255", charmap.Windows1255)},
+	{"Windows-1256", []string{"CP1256"}, singleByte("CP1256", charmap.Windows1256)},
+	{"Windows-1257", []string{"CP1257"}, singleByte("CP1257", charmap.Windows1257)},
+	{"Windows-1258", []string{"CP1258"}, singleByte("CP1258", charmap.Windows1258)},
+	{"CP437", []string{"IBM437"}, singleByte("CP437", charmap.CodePage437)},
+	{"CP850", []string{"IBM850"}, singleByte("CP850", charmap.CodePage850)},
+	{"CP866", []string{"IBM866"}, singleByte("CP866", charmap.CodePage866)},
+	{"KOI8-R", []string{"KOI8R"}, singleByte("KOI8R", charmap.KOI8R)},
+	{"KOI8-U", []string{"KOI8U"}, singleByte("KOI8U", charmap.KOI8U)},
+	{"Macintosh", []string{"MacRoman", "MAC"}, singleByte("MAC", charmap.Macintosh)},
+	{"CP037", []string{"EBCDIC", "IBM037"}, singleByte("CP037", charmap.CodePage037)},
+	{"CP500", []string{"IBM500"}, func() Encoding { return newSingleByte("CP500", charmap.CodePage037, cp500Patch) }},
+	{"CP1047", []string{"IBM1047"}, singleByte("CP1047", charmap.CodePage1047)},
+}
+
+func normalizeName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || c == '_' || c == ' ' {
+			return -1
+		}
+		return c
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// Names returns the names of all encodings selectable by name.
+func Names() []string {
+	names := make([]string, len(registry))
+	for i, e := range registry {
+		names[i] = e.name
+	}
+	return names
+}
+
+// Lookup returns the encoding for the name like "Shift_JIS" or "euc-jp".
+// The name is case-insensitive and `-`, `_` in it are ignored.
+// The string of ModeString is also accepted.
+func Lookup(name string) (Encoding, bool) {
+	name = normalizeName(name)
+	for _, e := range registry {
+		if normalizeName(e.name) == name {
+			return e.New(), true
+		}
+		for _, alias := range e.aliases {
+			if normalizeName(alias) == name {
+				return e.New(), true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,78 @@
+package encoding
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// _SingleByte is the encoding whose every byte is one character.
+// Undefined bytes are utf8.RuneError in the table.
+type _SingleByte struct {
+	name  string
+	table *[256]rune
+}
+
+func newSingleByte(name string, cm *charmap.Charmap, patch map[byte]rune) Encoding {
+	var table [256]rune
+	for i := range table {
+		table[i] = cm.DecodeByte(byte(i))
+	}
+	for b, r := range patch {
+		table[b] = r
+	}
+	return _SingleByte{name: name, table: &table}
+}
+
+// cp500Patch is the difference of EBCDIC CP500 (International) from CP037.
+var cp500Patch = map[byte]rune{
+	0x4A: '[',
+	0x4F: '!',
+	0x5A: ']',
+	0x5F: '^',
+	0xB0: '¢',
+	0xBA: '¬',
+	0xBB: '|',
+}
+
+func (_SingleByte) Count(byte, int64) int {
+	return 1
+}
+
+func (s _SingleByte) Decode(data []byte) rune {
+	if len(data) != 1 {
+		return utf8.RuneError
+	}
+	return s.table[data[0]]
+}
+
+func (s _SingleByte) EncodeFromString(str string) ([]byte, error) {
+	bytes := make([]byte, 0, len(str))
+	for _, r := range str {
+		found := false
+		for i, r1 := range s.table {
+			if r1 == r && r != utf8.RuneError {
+				bytes = append(bytes, byte(i))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("U+%04X: not found in %s", r, s.name)
+		}
+	}
+	return bytes, nil
+}
+
+func (s _SingleByte) RuneOver(cursor Pointer) (rune, int, int) {
+	theRune := s.table[cursor.Value()]
+	if theRune == utf8.RuneError {
+		return utf8.RuneError, 0, 1
+	}
+	return theRune, 0, 1
+}
+
+func (s _SingleByte) ModeString() string {
+	return s.name
+}
@@ -11,38 +11,84 @@ type _Block = []byte
 var ALLOC_SIZE = 4096
 
 type Buffer struct {
-	lines   *list.List
-	reader  *bufio.Reader
-	allsize int64
+	lines    *list.List
+	incoming chan Chunk
+	done     chan struct{}
+	allsize  int64
 }
 
+// Chunk is the data read in the background.
+type Chunk struct {
+	data []byte
+	err  error
+}
+
+// NewBuffer starts reading r in the background. The reader goroutine
+// reads only one chunk ahead of the one stored to the buffer.
 func NewBuffer(r io.Reader) *Buffer {
-	return &Buffer{
-		lines:   list.New(),
-		reader:  bufio.NewReader(r),
-		allsize: 0,
+	b := &Buffer{
+		lines:    list.New(),
+		incoming: make(chan Chunk),
+		done:     make(chan struct{}),
+		allsize:  0,
 	}
+	go func(reader *bufio.Reader, size int, incoming chan<- Chunk, done <-chan struct{}) {
+		for {
+			buffer := make([]byte, size)
+			n, err := reader.Read(buffer)
+			if n <= 0 && err == nil {
+				continue
+			}
+			select {
+			case incoming <- Chunk{data: buffer[:n], err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}(bufio.NewReader(r), ALLOC_SIZE, b.incoming, b.done)
+	return b
 }
 
 func (b *Buffer) Len() int64 {
 	return b.allsize
 }
 
+// Incoming returns the channel of the data read in the background, which
+// should be given to Store. It is nil after all data are stored.
+func (b *Buffer) Incoming() <-chan Chunk {
+	return b.incoming
+}
+
+// Store appends the chunk received from Incoming. It returns the error
+// of reading (io.EOF at the end).
+func (b *Buffer) Store(c Chunk) error {
+	if n := len(c.data); n > 0 {
+		b.lines.PushBack(_Block(c.data))
+		b.allsize += int64(n)
+	}
+	if c.err != nil {
+		b.incoming = nil
+	}
+	return c.err
+}
+
+// Fetch waits for the next chunk and stores it.
 func (b *Buffer) Fetch() error {
-	if b.reader == nil {
+	if b.incoming == nil {
 		return io.EOF
 	}
-	buffer := make([]byte, ALLOC_SIZE)
-	n, err := b.reader.Read(buffer)
+	return b.Store(<-b.incoming)
+}
 
-	if n > 0 {
-		b.lines.PushBack(_Block(buffer[:n]))
-		b.allsize += int64(n)
-	}
-	if err != nil {
-		b.reader = nil
+// Close stops reading in the background.
+func (b *Buffer) Close() {
+	if b.done != nil {
+		close(b.done)
+		b.done = nil
 	}
-	return err
 }
 
 func (b *Buffer) ReadAll() {
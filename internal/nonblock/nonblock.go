@@ -1,23 +1,26 @@
 package nonblock
 
-type _Response struct {
-	data string
-	err  error
+// Result is what the getter returned.
+type Result struct {
+	Data string
+	Err  error
 }
 
+// NonBlock calls the getter in its own goroutine only when requested,
+// so that the caller can wait for other events at the same time.
 type NonBlock struct {
 	chReq chan struct{}
-	chRes chan _Response
+	chRes chan Result
 }
 
 func New(getter func() (string, error)) *NonBlock {
 	chReq := make(chan struct{})
-	chRes := make(chan _Response)
+	chRes := make(chan Result)
 
 	go func() {
 		for _ = range chReq {
 			data, err := getter()
-			chRes <- _Response{data: data, err: err}
+			chRes <- Result{Data: data, Err: err}
 		}
 		close(chRes)
 	}()
@@ -28,19 +31,15 @@ func New(getter func() (string, error)) *NonBlock {
 	}
 }
 
-func (w *NonBlock) GetOr(work func() bool) (string, error) {
+// Request makes the getter called. Its result is sent to C. The next
+// request must be made after receiving it.
+func (w *NonBlock) Request() {
 	w.chReq <- struct{}{}
-	for {
-		select {
-		case res := <-w.chRes:
-			return res.data, res.err
-		default:
-			if cont := work(); !cont {
-				res := <-w.chRes
-				return res.data, res.err
-			}
-		}
-	}
+}
+
+// C returns the channel of the results.
+func (w *NonBlock) C() <-chan Result {
+	return w.chRes
 }
 
 func (w *NonBlock) Close() {
@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/nyaosorg/go-readline-ny"
 	"github.com/nyaosorg/go-readline-ny/simplehistory"
@@ -15,29 +17,39 @@ import (
 )
 
 const (
-	_KEY_CTRL_A = "\x01"
-	_KEY_CTRL_B = "\x02"
-	_KEY_CTRL_E = "\x05"
-	_KEY_CTRL_F = "\x06"
-	_KEY_CTRL_L = "\x0C"
-	_KEY_CTRL_N = "\x0E"
-	_KEY_CTRL_P = "\x10"
-	_KEY_DOWN   = "\x1B[B"
-	_KEY_ESC    = "\x1B"
-	_KEY_LEFT   = "\x1B[D"
-	_KEY_RIGHT  = "\x1B[C"
-	_KEY_UP     = "\x1B[A"
-	_KEY_F2     = "\x1B[OQ"
-	_KEY_DEL    = "\x1B[3~"
-	_KEY_ALT_A  = "\x1Ba"
-	_KEY_ALT_U  = "\x1Bu"
-	_KEY_ALT_L  = "\x1Bl"
-	_KEY_ALT_B  = "\x1Bb"
+	_KEY_CTRL_A             = "\x01"
+	_KEY_CTRL_B             = "\x02"
+	_KEY_CTRL_E             = "\x05"
+	_KEY_CTRL_F             = "\x06"
+	_KEY_CTRL_L             = "\x0C"
+	_KEY_CTRL_N             = "\x0E"
+	_KEY_CTRL_P             = "\x10"
+	_KEY_CTRL_T             = "\x14"
+	_KEY_CTRL_RIGHT_BRACKET = "\x1D"
+	_KEY_ENTER              = "\r"
+	_KEY_DOWN               = "\x1B[B"
+	_KEY_ESC                = "\x1B"
+	_KEY_LEFT               = "\x1B[D"
+	_KEY_RIGHT              = "\x1B[C"
+	_KEY_UP                 = "\x1B[A"
+	_KEY_F1                 = "\x1BOP"
+	_KEY_F2                 = "\x1B[OQ"
+	_KEY_DEL                = "\x1B[3~"
+	_KEY_ALT_A              = "\x1Ba"
+	_KEY_ALT_U              = "\x1Bu"
+	_KEY_ALT_L              = "\x1Bl"
+	_KEY_ALT_B              = "\x1Bb"
+	_KEY_ALT_E              = "\x1Be"
+	_KEY_ALT_D              = "\x1Bd"
+	_KEY_ALT_SHIFT_L        = "\x1BL"
+	_KEY_ALT_SHIFT_B        = "\x1BB"
+	_KEY_ALT_SHIFT_E        = "\x1BE"
+	_KEY_ALT_X              = "\x1Bx"
 )
 
-// keyFuncNext moves the cursor to the the next 16-bytes block.
+// keyFuncNext moves the cursor to the the next line.
 func keyFuncNext(this *Application) error {
-	if err := this.cursor.Skip(LINE_SIZE); err != nil {
+	if err := this.cursor.Skip(int64(this.lineSize())); err != nil {
 		if err != io.EOF {
 			return err
 		}
@@ -51,9 +63,9 @@ func keyFuncBackword(this *Application) error {
 	return nil
 }
 
-// keyFuncPrevious moves the cursor the the previous 16-bytes block.
+// keyFuncPrevious moves the cursor the the previous line.
 func keyFuncPrevious(this *Application) error {
-	this.cursor.Rewind(LINE_SIZE)
+	this.cursor.Rewind(int64(this.lineSize()))
 	return nil
 }
 
@@ -65,24 +77,31 @@ func keyFuncQuit(this *Application) error {
 	return nil
 }
 
+// keyFuncForceQuit quits without asking even if the data is changed (`:q!`).
+func keyFuncForceQuit(this *Application) error {
+	io.WriteString(this.out, "\n")
+	return io.EOF
+}
+
 // keyFuncForward moves the cursor to the next one byte.
 func keyFuncForward(this *Application) error {
 	this.cursor.Next()
 	return nil
 }
 
-// keyFuncGoBeginOfLine move the cursor the the top of the 16bytes-block.
+// keyFuncGoBeginOfLine move the cursor the the top of the line.
 func keyFuncGoBeginOfLine(this *Application) error {
-	n := this.cursor.Address() % LINE_SIZE
+	n := this.cursor.Address() % int64(this.lineSize())
 	if n > 0 {
 		this.cursor.Rewind(n)
 	}
 	return nil
 }
 
-// keyFuncGoEndOfLine move the cursor to the end of the current 16 byte block.
+// keyFuncGoEndOfLine move the cursor to the end of the current line.
 func keyFuncGoEndOfLine(this *Application) error {
-	n := LINE_SIZE - this.cursor.Address()%LINE_SIZE - 1
+	lineSize := int64(this.lineSize())
+	n := lineSize - this.cursor.Address()%lineSize - 1
 	if n > 0 {
 		this.cursor.Skip(n)
 	}
@@ -165,11 +184,26 @@ func keyFuncRemoveByte(this *Application) error {
 
 var overWritten = map[string]struct{}{}
 
-func getlineOr(out io.Writer, prompt string, defaultString string, history readline.IHistory, f func() bool) (string, error) {
+// getOrLoad requests the data of the worker and stores the data read in
+// the background into the buffer until it comes.
+func getOrLoad(worker *nonblock.NonBlock, buffer *large.Buffer) (string, error) {
+	worker.Request()
+	for {
+		select {
+		case res := <-worker.C():
+			return res.Data, res.Err
+		case c := <-buffer.Incoming():
+			buffer.Store(c)
+		}
+	}
+}
+
+// getlineOr reads a line while loading the data of buffer.
+func getlineOr(out io.Writer, prompt string, defaultString string, history readline.IHistory, buffer *large.Buffer) (string, error) {
 	worker := nonblock.New(func() (string, error) {
 		return getline(out, prompt, defaultString, history)
 	})
-	result, err := worker.GetOr(f)
+	result, err := getOrLoad(worker, buffer)
 	worker.Close()
 	return result, err
 }
@@ -178,10 +212,15 @@ var fnameHistory = simplehistory.New()
 
 func writeFile(buffer *large.Buffer, tty1 Tty, out io.Writer, fname string) (string, error) {
 	var err error
-	fname, err = getlineOr(out, "write to>", fname, fnameHistory, func() bool { return buffer.Fetch() == nil })
+	fname, err = getlineOr(out, "write to>", fname, fnameHistory, buffer)
 	if err != nil {
 		return "", err
 	}
+	return saveFile(buffer, tty1, out, fname)
+}
+
+// saveFile writes the data to fname without asking the name.
+func saveFile(buffer *large.Buffer, tty1 Tty, out io.Writer, fname string) (string, error) {
 	fd, err := os.OpenFile(fname, os.O_WRONLY|os.O_EXCL|os.O_CREATE, 0666)
 	if os.IsExist(err) {
 		if _, ok := overWritten[fname]; ok {
@@ -202,7 +241,14 @@ func writeFile(buffer *large.Buffer, tty1 Tty, out io.Writer, fname string) (str
 	}
 	buffer.WriteTo(fd)
 	fnameHistory.Add(fname)
-	return fname, fd.Close()
+	if err := fd.Close(); err != nil {
+		return fname, err
+	}
+	if backupPolicy == "none" {
+		// removed after writing because the data may be read from it lazily
+		os.Remove(fname + "~")
+	}
+	return fname, nil
 }
 
 func keyFuncWriteFile(this *Application) error {
@@ -216,13 +262,25 @@ func keyFuncWriteFile(this *Application) error {
 	return nil
 }
 
+// exWriteFile is `:w FILE`.
+func exWriteFile(app *Application, fname string) error {
+	newfname, err := saveFile(app.buffer, app.tty1, app.out, fname)
+	if err != nil {
+		app.message = err.Error()
+	} else {
+		app.dirty = false
+		app.savePath = newfname
+	}
+	return nil
+}
+
 var byteHistory = simplehistory.New()
 
 func keyFuncReplaceByte(this *Application) error {
 	bytes, err := getlineOr(this.out, "replace>",
 		fmt.Sprintf("0x%02X", this.cursor.Value()),
 		byteHistory,
-		func() bool { return this.buffer.Fetch() == nil })
+		this.buffer)
 	if err != nil {
 		this.message = err.Error()
 		return nil
@@ -264,46 +322,262 @@ func gotoAddress(app *Application, address int64) error {
 var addressHistory = simplehistory.New()
 
 func keyFuncGoTo(app *Application) error {
-	addressStr, err := getlineOr(app.out, "Goto Offset>", "0x", addressHistory, func() bool {
-		return app.buffer.Fetch() == nil
-	})
+	addressStr, err := getlineOr(app.out, "Goto Offset>", "0x", addressHistory, app.buffer)
 	if err != nil {
 		app.message = err.Error()
 		return nil
 	}
-	address, err := strconv.ParseInt(addressStr, 0, 64)
+	addressHistory.Add(addressStr)
+	return exGoTo(app, addressStr)
+}
+
+// exGoTo is `:goto EXPRESSION`.
+func exGoTo(app *Application, exp string) error {
+	address, err := evalAddress(exp, app)
 	if err != nil {
 		app.message = err.Error()
 		return nil
 	}
-	addressHistory.Add(addressStr)
+	if address < 0 {
+		app.message = fmt.Sprintf("%d: out of range", address)
+		return nil
+	}
+	return gotoAddress(app, address)
+}
+
+// keyFuncNextInvalid moves the cursor to the next byte sequence which can
+// not be decoded with the current encoding.
+func keyFuncNextInvalid(app *Application) error {
+	p := app.cursor.Clone()
+	_, step := encoding.Validate(app.encoding, p.Clone())
+	if r, pos, length := app.encoding.RuneOver(p.Clone()); r != utf8.RuneError {
+		step = length - pos
+	}
+	for {
+		if p.Skip(int64(step)) != nil {
+			app.message = "no invalid sequences after the cursor"
+			return nil
+		}
+		var kind encoding.Invalid
+		kind, step = encoding.Validate(app.encoding, p.Clone())
+		if kind != encoding.Valid {
+			app.message = fmt.Sprintf("0x%X: %s", p.Address(), kind)
+			return gotoAddress(app, p.Address())
+		}
+	}
+}
+
+func isMarkName(key string) bool {
+	return len(key) == 1 && ('a' <= key[0] && key[0] <= 'z' || 'A' <= key[0] && key[0] <= 'Z')
+}
+
+// keyFuncSetMark records the cursor address as the mark named by the next key.
+func keyFuncSetMark(app *Application) error {
+	fmt.Fprintf(app.out, "%s\rmark>%s", _STATUS_COLOR_ON, _ANSI_ERASE_LINE)
+	key, err := app.tty1.GetKey()
+	if err != nil || !isMarkName(key) {
+		return nil
+	}
+	app.marks[rune(key[0])] = app.cursor.Address()
+	app.message = fmt.Sprintf("mark '%s' = 0x%X", key, app.cursor.Address())
+	return nil
+}
+
+// keyFuncJumpToMark moves the cursor to the mark named by the next key.
+func keyFuncJumpToMark(app *Application) error {
+	fmt.Fprintf(app.out, "%s\rjump to mark>%s", _STATUS_COLOR_ON, _ANSI_ERASE_LINE)
+	key, err := app.tty1.GetKey()
+	if err != nil || !isMarkName(key) {
+		return nil
+	}
+	address, ok := app.marks[rune(key[0])]
+	if !ok {
+		app.message = fmt.Sprintf("mark '%s' is not set", key)
+		return nil
+	}
+	return gotoAddress(app, address)
+}
+
+// keyFuncFollowPointer reads the integer under the cursor as an offset,
+// pushes the current address and jumps there.
+func keyFuncFollowPointer(app *Application) error {
+	pt := app.pointerType
+	value, err := readInteger(app.buffer, app.cursor.Address(), pt.size, pt.isLittleEndian)
+	if err != nil {
+		app.message = err.Error()
+		return nil
+	}
+	address := int64(value) + pt.base
+	if value >= 1<<63 || address < 0 {
+		app.message = fmt.Sprintf("0x%X: out of range", value)
+		return nil
+	}
+	if app.buffer.Len() <= address {
+		app.buffer.ReadAll()
+		if app.buffer.Len() <= address {
+			app.message = fmt.Sprintf("0x%X: beyond the end of data", address)
+			return nil
+		}
+	}
+	app.jumpStack = append(app.jumpStack, app.cursor.Address())
+	return gotoAddress(app, address)
+}
+
+// keyFuncReturnFromPointer moves the cursor back to the address where
+// the last keyFuncFollowPointer jumped from.
+func keyFuncReturnFromPointer(app *Application) error {
+	if len(app.jumpStack) <= 0 {
+		app.message = "jump stack is empty"
+		return nil
+	}
+	tail := len(app.jumpStack) - 1
+	address := app.jumpStack[tail]
+	app.jumpStack = app.jumpStack[:tail]
 	return gotoAddress(app, address)
 }
 
+var pointerTypeHistory = simplehistory.New()
+
+// keyFuncSetPointerType changes the width, byte order and base address
+// which keyFuncFollowPointer uses.
+func keyFuncSetPointerType(app *Application) error {
+	text, err := getlineOr(app.out, "pointer type>", app.pointerType.String(), pointerTypeHistory, app.buffer)
+	if err != nil {
+		app.message = err.Error()
+		return nil
+	}
+	pointerTypeHistory.Add(text)
+	return exSetPointerType(app, text)
+}
+
+// exSetPointerType is `:set-pointer-type TYPE`.
+func exSetPointerType(app *Application, text string) error {
+	pt, err := parsePointerType(text, app)
+	if err != nil {
+		app.message = err.Error()
+		return nil
+	}
+	app.pointerType = pt
+	return nil
+}
+
+func (app *Application) setEncoding(enc encoding.Encoding) {
+	app.encoding = enc
+	app.autoEncoding = false
+}
+
+// keyFuncDetectEncoding guesses the encoding again from the data after
+// the cursor.
+func keyFuncDetectEncoding(app *Application) error {
+	app.autoDetect(app.cursor)
+	return nil
+}
+
 func keyFuncDbcsMode(app *Application) error {
-	app.encoding = encoding.DBCSEncoding{}
+	enc, err := encoding.ANSI()
+	if err != nil {
+		app.message = err.Error()
+		return nil
+	}
+	app.setEncoding(enc)
+	return nil
+}
+
+// indexOfEncoding returns the index of the name of enc in names or -1.
+func indexOfEncoding(names []string, enc encoding.Encoding) int {
+	for i, name := range names {
+		if e, ok := encoding.Lookup(name); ok && e.ModeString() == enc.ModeString() {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyFuncSelectEncoding changes the encoding to the one selected from
+// the list of all encodings.
+func keyFuncSelectEncoding(app *Application) error {
+	names := encoding.Names()
+	current := indexOfEncoding(names, app.encoding)
+	if current < 0 {
+		current = 0
+	}
+	if i := pickOne(app.tty1, app.out, "encoding:", names, current, app.screenWidth); i >= 0 {
+		enc, _ := encoding.Lookup(names[i])
+		app.setEncoding(enc)
+	}
+	return nil
+}
+
+// exSelectEncoding is `:enc NAME`. The name "auto" detects it again.
+func exSelectEncoding(app *Application, name string) error {
+	if strings.EqualFold(name, "auto") {
+		return keyFuncDetectEncoding(app)
+	}
+	enc, ok := encoding.Lookup(name)
+	if !ok {
+		app.message = name + ": no such encoding"
+		return nil
+	}
+	app.setEncoding(enc)
+	return nil
+}
+
+// keyFuncSelectEncoding2 shows the second character part decoded with the
+// encoding selected from the list, or hides it by selecting "(none)".
+// The line gets shorter on the narrow screen.
+func keyFuncSelectEncoding2(app *Application) error {
+	names := append([]string{"(none)"}, encoding.Names()...)
+	current := 0
+	if app.encoding2 != nil {
+		if i := indexOfEncoding(names[1:], app.encoding2); i >= 0 {
+			current = i + 1
+		}
+	}
+	i := pickOne(app.tty1, app.out, "second encoding:", names, current, app.screenWidth)
+	if i == 0 {
+		app.encoding2 = nil
+	} else if i > 0 {
+		app.encoding2, _ = encoding.Lookup(names[i])
+	}
+	return nil
+}
+
+// keyFuncCycleByteFormat switches the representation of the bytes
+// between hexadecimal, octal, decimal and binary.
+func keyFuncCycleByteFormat(app *Application) error {
+	app.byteFormat = (app.byteFormat + 1) % len(byteFormats)
 	return nil
 }
 
 func keyFuncUtf8Mode(app *Application) error {
-	app.encoding = encoding.UTF8Encoding{}
+	app.setEncoding(encoding.UTF8Encoding{})
 	return nil
 }
 
 func keyFuncUtf16LeMode(app *Application) error {
-	app.encoding = encoding.UTF16LE()
+	app.setEncoding(encoding.UTF16LE())
 	return nil
 }
 
 func keyFuncUtf16BeMode(app *Application) error {
-	app.encoding = encoding.UTF16BE()
+	app.setEncoding(encoding.UTF16BE())
+	return nil
+}
+
+func keyFuncUtf32LeMode(app *Application) error {
+	app.setEncoding(encoding.UTF32LE())
+	return nil
+}
+
+func keyFuncUtf32BeMode(app *Application) error {
+	app.setEncoding(encoding.UTF32BE())
 	return nil
 }
 
 var expHistory = simplehistory.New()
 
 func readExpression(app *Application, prompt string) (string, error) {
-	exp, err := getlineOr(app.out, prompt, "0x00", expHistory, func() bool { return app.buffer.Fetch() == nil })
+	exp, err := getlineOr(app.out, prompt, "0x00", expHistory, app.buffer)
 	if err != nil {
 		return "", err
 	}
@@ -317,8 +591,12 @@ func keyFuncInsertExp(app *Application) error {
 		app.message = err.Error()
 		return nil
 	}
-	err = app.InsertExp(exp)
-	if err != nil {
+	return exInsertExp(app, exp)
+}
+
+// exInsertExp is `:insert-data EXPRESSION`.
+func exInsertExp(app *Application, exp string) error {
+	if err := app.InsertExp(exp); err != nil {
 		app.message = err.Error()
 	}
 	return nil
@@ -330,8 +608,12 @@ func keyFuncAppendExp(app *Application) error {
 		app.message = err.Error()
 		return nil
 	}
-	err = app.AppendExp(exp)
-	if err != nil {
+	return exAppendExp(app, exp)
+}
+
+// exAppendExp is `:append-data EXPRESSION`.
+func exAppendExp(app *Application, exp string) error {
+	if err := app.AppendExp(exp); err != nil {
 		app.message = err.Error()
 	}
 	return nil
@@ -353,44 +635,65 @@ func keyFuncUndo(app *Application) error {
 	return nil
 }
 
-var jumpTable = map[string]func(this *Application) error{
-	"u":         keyFuncUndo,
-	"i":         keyFuncInsertExp,
-	"a":         keyFuncAppendExp,
-	_KEY_ALT_A:  keyFuncDbcsMode,
-	_KEY_ALT_U:  keyFuncUtf8Mode,
-	_KEY_ALT_L:  keyFuncUtf16LeMode,
-	_KEY_ALT_B:  keyFuncUtf16BeMode,
-	"&":         keyFuncGoTo,
-	"q":         keyFuncQuit,
-	_KEY_ESC:    keyFuncQuit,
-	"j":         keyFuncNext,
-	_KEY_DOWN:   keyFuncNext,
-	_KEY_CTRL_N: keyFuncNext,
-	"h":         keyFuncBackword,
-	"\b":        keyFuncBackword,
-	_KEY_LEFT:   keyFuncBackword,
-	_KEY_CTRL_B: keyFuncBackword,
-	"k":         keyFuncPrevious,
-	_KEY_UP:     keyFuncPrevious,
-	_KEY_CTRL_P: keyFuncPrevious,
-	"l":         keyFuncForward,
-	" ":         keyFuncForward,
-	_KEY_RIGHT:  keyFuncForward,
-	_KEY_CTRL_F: keyFuncForward,
-	"0":         keyFuncGoBeginOfLine,
-	"^":         keyFuncGoBeginOfLine,
-	_KEY_CTRL_A: keyFuncGoBeginOfLine,
-	"$":         keyFuncGoEndOfLine,
-	_KEY_CTRL_E: keyFuncGoEndOfLine,
-	"<":         keyFuncGoBeginOfFile,
-	">":         keyFuncGoEndOfFile,
-	"G":         keyFuncGoEndOfFile,
-	"p":         keyFuncPasteAfter,
-	"P":         keyFuncPasteBefore,
-	"x":         keyFuncRemoveByte,
-	_KEY_DEL:    keyFuncRemoveByte,
-	"w":         keyFuncWriteFile,
-	"r":         keyFuncReplaceByte,
-	_KEY_CTRL_L: keyFuncRepaint,
+// jumpTable is the map from keys to the names of the commands.
+var jumpTable = map[string]string{
+	"u":                     "undo",
+	"i":                     "insert-data",
+	"a":                     "append-data",
+	_KEY_ALT_A:              "ansi-mode",
+	_KEY_ALT_U:              "utf8-mode",
+	_KEY_ALT_L:              "utf16le-mode",
+	_KEY_ALT_B:              "utf16be-mode",
+	_KEY_ALT_SHIFT_L:        "utf32le-mode",
+	_KEY_ALT_SHIFT_B:        "utf32be-mode",
+	_KEY_ALT_E:              "select-encoding",
+	_KEY_ALT_SHIFT_E:        "select-second-encoding",
+	_KEY_ALT_X:              "cycle-byte-format",
+	_KEY_ALT_D:              "detect-encoding",
+	"&":                     "goto",
+	"m":                     "set-mark",
+	"'":                     "jump-to-mark",
+	_KEY_ENTER:              "follow-pointer",
+	_KEY_CTRL_RIGHT_BRACKET: "follow-pointer",
+	_KEY_CTRL_T:             "return-from-pointer",
+	"@":                     "set-pointer-type",
+	"!":                     "next-invalid",
+	":":                     "ex-command",
+	"?":                     "help",
+	_KEY_F1:                 "help",
+	"q":                     "quit",
+	_KEY_ESC:                "quit",
+	"j":                     "next-line",
+	_KEY_DOWN:               "next-line",
+	_KEY_CTRL_N:             "next-line",
+	"h":                     "backward",
+	"\b":                    "backward",
+	_KEY_LEFT:               "backward",
+	_KEY_CTRL_B:             "backward",
+	"k":                     "previous-line",
+	_KEY_UP:                 "previous-line",
+	_KEY_CTRL_P:             "previous-line",
+	"l":                     "forward",
+	" ":                     "forward",
+	_KEY_RIGHT:              "forward",
+	_KEY_CTRL_F:             "forward",
+	"0":                     "beginning-of-line",
+	"^":                     "beginning-of-line",
+	_KEY_CTRL_A:             "beginning-of-line",
+	"$":                     "end-of-line",
+	_KEY_CTRL_E:             "end-of-line",
+	"<":                     "beginning-of-file",
+	">":                     "end-of-file",
+	"G":                     "end-of-file",
+	"p":                     "paste-after",
+	"P":                     "paste-before",
+	"x":                     "remove-byte",
+	_KEY_DEL:                "remove-byte",
+	"w":                     "write-file",
+	"r":                     "replace-byte",
+	"R":                     "replace-mode",
+	"b":                     "bit-view",
+	"I":                     "insert-mode",
+	_KEY_TAB:                "text-mode",
+	_KEY_CTRL_L:             "repaint",
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/mattn/go-colorable"
 	"github.com/mattn/go-runewidth"
+	"golang.org/x/text/unicode/runenames"
 
 	"github.com/nyaosorg/go-ttyadapter"
 	"github.com/nyaosorg/go-ttyadapter/tty8"
@@ -28,19 +30,19 @@ const LINE_SIZE = 16
 const (
 	_ANSI_CURSOR_OFF       = "\x1B[?25l"
 	_ANSI_CURSOR_ON        = "\x1B[?25h"
-	_ANSI_YELLOW           = "\x1B[0;33;1m"
 	_ANSI_RESET            = "\x1B[0m"
 	_ANSI_UNDERLINE_ON     = "\x1B[4m"
 	_ANSI_UNDERLINE_OFF    = "\x1B[24m"
 	_ANSI_ERASE_LINE       = "\x1B[0K"
 	_ANSI_ERASE_SCRN_AFTER = "\x1B[0J"
-
-	_CURSOR_COLOR_ON  = "\x1B[37;40;1;7m"
-	_CURSOR_COLOR_OFF = "\x1B[27;22m"
-	_CELL1_COLOR_ON   = "\x1B[37;40;22m"
-	_CELL1_COLOR_OFF  = ""
-	_CELL2_COLOR_ON   = "\x1B[37;40;1m"
-	_CELL2_COLOR_OFF  = "\x1B[22m"
+	_ANSI_CURSOR_HOME      = "\x1B[H"
+	_ANSI_ALT_SCREEN_ON    = "\x1B[?1049h"
+	_ANSI_ALT_SCREEN_OFF   = "\x1B[?1049l"
+
+	_CURSOR_COLOR_OFF    = "\x1B[27;22m"
+	_SELECTION_COLOR_OFF = "\x1B[27;22m"
+	_CELL1_COLOR_OFF     = ""
+	_CELL2_COLOR_OFF     = "\x1B[22m"
 )
 
 const (
@@ -69,25 +71,62 @@ var version string = "snapshot"
 
 // See. en.wikipedia.org/wiki/Unicode_control_characters#Control_pictures
 
-func makeHexPart(pointer *large.Pointer, cursorAddress int64, out *strings.Builder) bool {
+// byteFormat is the representation of a byte in the hex part.
+type byteFormat struct {
+	name    string
+	verb    string // for fmt.Sprintf
+	width   int    // columns of a cell
+	nibbles bool   // each nibble has its own column
+}
+
+var byteFormats = []byteFormat{
+	{name: "HEX", verb: "%02X", width: 2, nibbles: true},
+	{name: "OCT", verb: "%03o", width: 3},
+	{name: "DEC", verb: "%3d", width: 3},
+	{name: "BIN", verb: "%08b", width: 8},
+}
+
+// lineWidth returns the columns of a line with `panes` character parts.
+func lineWidth(format byteFormat, lineSize, panes int) int {
+	return 8 + 1 + lineSize*(format.width+1) - 1 + panes*(1+lineSize)
+}
+
+func makeHexPart(pointer *large.Pointer, cursorAddress int64, mode cursorMode, format byteFormat, lineSize int, sel selRange, out *strings.Builder) bool {
 	fmt.Fprintf(out, "%s%08X%s ", _CELL2_COLOR_ON, pointer.Address(), _CELL2_COLOR_OFF)
 	var fieldSeperator string
-	for i := 0; i < LINE_SIZE; i++ {
+	for i := 0; i < lineSize; i++ {
 		var on, off string
-		if pointer.Address() == cursorAddress {
+		if pointer.Address() == cursorAddress && mode != cursorOnText {
 			on = _CURSOR_COLOR_ON
 			off = _CURSOR_COLOR_OFF
 		} else if ((i >> 2) & 1) == 0 {
-			on = _CELL1_COLOR_ON
+			on = classColor(classOfByte(pointer.Value()), false)
 			off = _CELL1_COLOR_OFF
 		} else {
-			on = _CELL2_COLOR_ON
+			on = classColor(classOfByte(pointer.Value()), true)
 			off = _CELL2_COLOR_OFF
 		}
-		fmt.Fprintf(out, "%s%s%02X%s", fieldSeperator, on, pointer.Value(), off)
+		if sel.contains(pointer.Address()) && pointer.Address() != cursorAddress {
+			on += _SELECTION_COLOR_ON
+			off = _SELECTION_COLOR_OFF + off
+		}
+		if column := mode.column(format); pointer.Address() == cursorAddress && column >= 0 {
+			// highlight only the digit to be typed or the bit to be toggled
+			cell := fmt.Sprintf(format.verb, pointer.Value())
+			fmt.Fprintf(out, "%s%s", fieldSeperator, classColor(classOfByte(pointer.Value()), false))
+			for j := 0; j < len(cell); j++ {
+				if j == column {
+					fmt.Fprintf(out, "%s%c%s", _CURSOR_COLOR_ON, cell[j], _CURSOR_COLOR_OFF)
+				} else {
+					out.WriteByte(cell[j])
+				}
+			}
+		} else {
+			fmt.Fprintf(out, "%s%s"+format.verb+"%s", fieldSeperator, on, pointer.Value(), off)
+		}
 		if err := pointer.Next(); err != nil {
-			for ; i < LINE_SIZE-1; i++ {
-				out.WriteString("   ")
+			for ; i < lineSize-1; i++ {
+				out.WriteString(strings.Repeat(" ", format.width+1))
 			}
 			return false
 		}
@@ -100,75 +139,240 @@ var dontview = map[rune]rune{
 	'\u000a': _HALFWIDTH_DOWNWARDS_ARROW,
 	'\u000d': _HALFWIDTH_LEFTWARDS_ARROW,
 	'\t':     _RIGHTWARDS_ARROW_TO_BAR,
-	'\u202e': '.', // Right-to-Left override
-	'\u202d': '.', // Left-to-Right override
-	'\u202c': '.', // Pop Directional Formatting
 }
 
-func makeAsciiPart(enc encoding.Encoding, pointer *large.Pointer, cursorAddress int64, out *strings.Builder) bool {
-	for i := 0; i < LINE_SIZE; {
-		var c rune
-		startAddress := pointer.Address()
-		b := pointer.Value()
+// invisibleView is the placeholders for the characters which have no
+// width or change the direction of the text after them.
+var invisibleView = map[rune]rune{
+	'\u200b': '_',                        // Zero Width Space
+	'\u200c': '_',                        // Zero Width Non-Joiner
+	'\u200d': '_',                        // Zero Width Joiner
+	'\u2060': '_',                        // Word Joiner
+	'\ufeff': '_',                        // Zero Width No-Break Space (BOM)
+	'\u200e': '>',                        // Left-to-Right Mark
+	'\u200f': '<',                        // Right-to-Left Mark
+	'\u061c': '<',                        // Arabic Letter Mark
+	'\u202a': '>',                        // Left-to-Right Embedding
+	'\u202b': '<',                        // Right-to-Left Embedding
+	'\u202c': '|',                        // Pop Directional Formatting
+	'\u202d': '>',                        // Left-to-Right Override
+	'\u202e': '<',                        // Right-to-Left Override
+	'\u2066': '>',                        // Left-to-Right Isolate
+	'\u2067': '<',                        // Right-to-Left Isolate
+	'\u2068': '~',                        // First Strong Isolate
+	'\u2069': '|',                        // Pop Directional Isolate
+	'\u2028': _HALFWIDTH_DOWNWARDS_ARROW, // Line Separator
+	'\u2029': _HALFWIDTH_DOWNWARDS_ARROW, // Paragraph Separator
+}
+
+const _DOTTED_CIRCLE = '\u25CC'
+
+// _WIDE_OVER_LINE is shown instead of the wide character which starts at
+// the last column and does not fit in the line.
+const _WIDE_OVER_LINE = "+"
+
+func isVariationSelector(c rune) bool {
+	return 0xFE00 <= c && c <= 0xFE0F || 0xE0100 <= c && c <= 0xE01EF
+}
+
+// viewOf returns the text to show the character and its color.
+// Every character which is invisible by itself is replaced with
+// a visible placeholder.
+func viewOf(c rune) (string, string) {
+	if _c, ok := dontview[c]; ok {
+		return string(_c), classColor(classWhitespace, false)
+	}
+	if _c, ok := invisibleView[c]; ok {
+		return string(_c), _PLACEHOLDER_COLOR_ON
+	}
+	if unicode.IsControl(c) {
+		return ".", classColor(classOfRune(c), false)
+	}
+	if isVariationSelector(c) {
+		return "v", _PLACEHOLDER_COLOR_ON
+	}
+	if unicode.In(c, unicode.Mn, unicode.Me) {
+		// a combining mark is put on the dotted circle not to be combined
+		// with the previous character.
+		return string([]rune{_DOTTED_CIRCLE, c}), _PLACEHOLDER_COLOR_ON
+	}
+	if unicode.Is(unicode.Cf, c) || runewidth.RuneWidth(c) <= 0 {
+		return "_", _PLACEHOLDER_COLOR_ON
+	}
+	return string(c), classColor(classOfRune(c), false)
+}
+
+// invalidView is how the bytes which can not be decoded are shown: with
+// the color for the broken sequences (red) or the one for the well-formed
+// but forbidden ones (magenta).
+var invalidView = map[encoding.Invalid]struct {
+	glyph     rune
+	forbidden bool
+}{
+	encoding.InvalidByte:       {'X', false},
+	encoding.StrayContinuation: {'C', false},
+	encoding.Truncated:         {'T', false},
+	encoding.Overlong:          {'O', true},
+	encoding.Surrogate:         {'S', true},
+	encoding.OutOfRange:        {'R', true},
+}
 
-		var runeBuffer [utf8.UTFMax]byte
-		savePointer := pointer.Clone()
+// padAsciiPart fills the columns after the end of the data for the part
+// drawn next to the character part.
+func padAsciiPart(i, lineSize int, out *strings.Builder) {
+	for ; i < lineSize; i++ {
+		out.WriteByte(' ')
+	}
+}
 
-		length := enc.Count(b, pointer.Address())
-		runeBuffer[0] = b
-		readCount := 1
-		for j := 1; j < length && pointer.Next() == nil; j++ {
-			runeBuffer[j] = pointer.Value()
-			readCount++
+// invalidOver returns the position of the pointer in the sequence which
+// can not be decoded and started before the pointer, as RuneOver does for
+// the characters. pos is 0 when there is no such sequence.
+func invalidOver(enc encoding.Encoding, pointer *large.Pointer) (pos, length int) {
+	for k := utf8.UTFMax - 1; k > 0; k-- {
+		if pointer.Address() < int64(k) {
+			continue
 		}
-		c = enc.Decode(runeBuffer[:readCount])
+		p := pointer.Clone()
+		p.Rewind(int64(k))
+		if kind, n := encoding.Validate(enc, p); kind != encoding.Valid && n > k {
+			return k, n
+		}
+	}
+	return 0, 0
+}
 
+func makeAsciiPart(enc encoding.Encoding, pointer *large.Pointer, cursorAddress int64, lineSize int, out *strings.Builder) bool {
+	i := 0
+	r, pos, length := enc.RuneOver(pointer.Clone())
+	if r == utf8.RuneError || pos <= 0 {
+		pos, length = invalidOver(enc, pointer)
+	}
+	if pos > 0 {
+		// the rest of the character or the invalid sequence started on
+		// the previous line
+		for ; pos < length; pos++ {
+			if pointer.Address() == cursorAddress {
+				out.WriteString(_CURSOR_COLOR_ON + " " + _CURSOR_COLOR_OFF)
+			} else {
+				out.WriteByte(' ')
+			}
+			i++
+			if pointer.Next() != nil {
+				padAsciiPart(i, lineSize, out)
+				return false
+			}
+		}
+	}
+	for i < lineSize {
+		startAddress := pointer.Address()
+		c, length := encoding.DecodeAt(enc, pointer.Clone())
 		if c == utf8.RuneError {
+			if kind, n := encoding.Validate(enc, pointer.Clone()); kind != encoding.Valid {
+				view := invalidView[kind]
+				pointer.Skip(int64(n - 1))
+				on := _INVALID_COLOR_ON
+				if view.forbidden {
+					on = _FORBIDDEN_COLOR_ON
+				}
+				if startAddress <= cursorAddress && cursorAddress <= pointer.Address() {
+					on = _CURSOR_COLOR_ON
+				}
+				out.WriteString(on)
+				// the rest over the end of the line is padded by the
+				// next line.
+				for j := 0; j < n && i+j < lineSize; j++ {
+					out.WriteRune(view.glyph)
+				}
+				out.WriteString(_CURSOR_COLOR_OFF)
+				i += n
+				if pointer.Next() != nil {
+					padAsciiPart(i, lineSize, out)
+					return false
+				}
+				continue
+			}
 			c = '.'
-			length = 1
-			pointer = savePointer
+		} else if length > 1 {
+			pointer.Skip(int64(length - 1))
 		}
 
-		if _c, ok := dontview[c]; ok {
-			c = _c
-		} else if unicode.IsControl(c) {
-			c = '.'
+		// keep one column per byte to align with the hex part. The rest
+		// of the character on the next line is padded by the next line.
+		room := length
+		if lineSize-i < room {
+			room = lineSize - i
 		}
-
+		text, on := viewOf(c)
+		if runewidth.StringWidth(text) > room {
+			// the wide character at the end of the line
+			text, on = _WIDE_OVER_LINE, _PLACEHOLDER_COLOR_ON
+		}
+		off := _CELL1_COLOR_OFF
 		if startAddress <= cursorAddress && cursorAddress <= pointer.Address() {
-			out.WriteString(_CURSOR_COLOR_ON)
-			out.WriteRune(c)
-			out.WriteString(_CURSOR_COLOR_OFF)
-		} else {
-			out.WriteString(_CELL1_COLOR_ON)
-			out.WriteRune(c)
-			out.WriteString(_CELL1_COLOR_OFF)
+			on = _CURSOR_COLOR_ON
+			off = _CURSOR_COLOR_OFF
 		}
-		if length == 3 {
+		out.WriteString(on)
+		out.WriteString(text)
+		out.WriteString(off)
+
+		for w := runewidth.StringWidth(text); w < room; w++ {
 			out.WriteByte(' ')
-		} else if length == 4 {
-			out.WriteString("  ")
 		}
 		i += length
 		if pointer.Next() != nil {
+			padAsciiPart(i, lineSize, out)
 			return false
 		}
 	}
 	return true
 }
 
-func makeLineImage(enc encoding.Encoding, pointer *large.Pointer, cursorAddress int64) (string, bool) {
+// makeRulerLine returns the offsets of the columns for the header of the
+// full-screen mode.
+func makeRulerLine(format byteFormat, lineSize, panes int) string {
+	var out strings.Builder
+	out.WriteString("  Offset")
+	verb := "%*X"
+	if format.width == 2 {
+		verb = "%0*X"
+	}
+	for i := 0; i < lineSize; i++ {
+		out.WriteByte(' ')
+		fmt.Fprintf(&out, verb, format.width, i)
+	}
+	for ; panes > 0; panes-- {
+		out.WriteByte(' ')
+		for i := 0; i < lineSize; i++ {
+			fmt.Fprintf(&out, "%X", i%16)
+		}
+	}
+	return out.String()
+}
+
+// makeLineImage draws one line. When enc2 is not nil, the second character
+// part decoded with it is drawn next to the first one. The bytes in sel
+// are highlighted in the hex part.
+func makeLineImage(enc, enc2 encoding.Encoding, pointer *large.Pointer, cursorAddress int64, mode cursorMode, format byteFormat, lineSize int, sel selRange) (string, bool) {
 	var out strings.Builder
 	off := ""
-	if p := pointer.Address(); p <= cursorAddress && cursorAddress < p+LINE_SIZE {
+	if p := pointer.Address(); p <= cursorAddress && cursorAddress < p+int64(lineSize) {
 		out.WriteString(_ANSI_UNDERLINE_ON)
 		off = _ANSI_UNDERLINE_OFF
 	}
 
 	asciiPointer := *pointer
-	hasNextLine := makeHexPart(pointer, cursorAddress, &out)
+	hasNextLine := makeHexPart(pointer, cursorAddress, mode, format, lineSize, sel, &out)
 	out.WriteByte(' ')
-	makeAsciiPart(enc, &asciiPointer, cursorAddress, &out)
+	if enc2 != nil {
+		asciiPointer2 := asciiPointer
+		makeAsciiPart(enc, &asciiPointer, cursorAddress, lineSize, &out)
+		out.WriteByte(' ')
+		makeAsciiPart(enc2, &asciiPointer2, cursorAddress, lineSize, &out)
+	} else {
+		makeAsciiPart(enc, &asciiPointer, cursorAddress, lineSize, &out)
+	}
 
 	out.WriteString(_ANSI_ERASE_LINE)
 	out.WriteString(off)
@@ -176,14 +380,21 @@ func makeLineImage(enc encoding.Encoding, pointer *large.Pointer, cursorAddress
 }
 
 func (app *Application) View() (int, error) {
-	h := app.screenHeight - 1
+	if app.help != nil {
+		return app.help.view(app)
+	}
+	h := app.dataHeight()
 	out := app.out
 	count := 0
 
 	cursor := app.window.Clone()
 	cursorAddress := app.cursor.Address()
+	mode := app.cursorMode()
+	format := app.currentByteFormat()
+	lineSize := app.lineSize()
+	sel := app.selectedRange()
 	for {
-		line, cont := makeLineImage(app.encoding, cursor, cursorAddress)
+		line, cont := makeLineImage(app.encoding, app.encoding2, cursor, cursorAddress, mode, format, lineSize, sel)
 
 		if f := app.cache[count]; f != line {
 			io.WriteString(out, line)
@@ -212,35 +423,132 @@ type Application struct {
 	message      string
 	cache        map[int]string
 	encoding     encoding.Encoding
+	autoEncoding bool              // encoding was selected by detectEncoding
+	detectAt     int64             // the address to guess the encoding again (-1: none)
+	detectedLen  int64             // the size of the data at the last guess
+	encoding2    encoding.Encoding // for the second character part (nil: hidden)
+	byteFormat   int               // index of byteFormats
 	undoFuncs    []func(app *Application)
+	marks        map[rune]int64
+	pointerType  pointerType
+	jumpStack    []int64
+	typing       *typingSession
+	bitView      *bitSession
+	help         *helpView // the help screen shown instead of the data
+	maxLineSize  int       // bytes per line on the wide screen
+	fullScreen   bool      // use the alternate screen instead of drawing inline
+	mouse        string    // on, off or auto (on only in the full-screen mode)
+	mouseOn      bool      // the mouse reports of the terminal are turned on
+	selection    *selection
+	pendingMouse []mouseEvent  // waiting for the cursor position report
+	viewTop      int           // the row of the screen where the data starts
+	viewLines    int           // the lines from the top of the view to the status line
+	resized      chan struct{} // notified by the tty on resizing the terminal
 }
 
+// dataHeight returns how many lines the data can use. The full-screen mode
+// reserves the header line for the ruler.
 func (app *Application) dataHeight() int {
+	if app.fullScreen {
+		return app.screenHeight - 2
+	}
 	return app.screenHeight - 1
 }
 
-func detectEncoding(p *large.Pointer) encoding.Encoding {
+// currentByteFormat returns the layout of the hex part. It is binary
+// in the bit view.
+func (app *Application) currentByteFormat() byteFormat {
+	if app.bitView != nil {
+		return binaryFormat
+	}
+	return byteFormats[app.byteFormat]
+}
+
+// panes returns the number of the character parts.
+func (app *Application) panes() int {
+	if app.encoding2 != nil {
+		return 2
+	}
+	return 1
+}
+
+// lineSize returns how many bytes are shown in a line. It is maxLineSize
+// or less to fit the line into the screen.
+func (app *Application) lineSize() int {
+	format := app.currentByteFormat()
+	size := app.maxLineSize
+	for size > 1 && app.screenWidth > 0 && lineWidth(format, size, app.panes()) >= app.screenWidth {
+		size /= 2
+	}
+	return size
+}
+
+// detectSampleSize is how many bytes detectEncoding reads to guess.
+const detectSampleSize = 4096
+
+// detectEncoding guesses the encoding of the data from the pointer by the
+// BOM, or by the sample of it if the pointer is at the top of the data.
+// The sample is taken from the first `loaded` bytes not to wait for the
+// rest of the data. full is false when the sample is shorter than wanted.
+func detectEncoding(p *large.Pointer, loaded int64) (enc encoding.Encoding, full bool) {
 	p = p.Clone()
-	byte1 := p.Value()
-	if p.Next() == nil {
-		byte2 := p.Value()
-		if byte1 == 0xFF && byte2 == 0xFE {
-			return encoding.UTF16LE()
-		}
-		if byte1 == 0xFE && byte2 == 0xFF {
-			return encoding.UTF16BE()
+	address := p.Address()
+	sample := []byte{p.Value()}
+	for len(sample) < detectSampleSize && p.Address()+1 < loaded && p.Next() == nil {
+		sample = append(sample, p.Value())
+	}
+	full = len(sample) >= detectSampleSize
+	if address == 0 {
+		if enc := encoding.DetectBOM(sample); enc != nil {
+			return enc, full
 		}
 	}
-	return encoding.UTF8Encoding{}
+	return encoding.Detect(sample, address), full
+}
+
+// autoDetect selects the encoding guessed from the data at the pointer.
+// While the sample is short, redetect guesses again as more data arrive.
+func (app *Application) autoDetect(p *large.Pointer) {
+	enc, full := detectEncoding(p, app.buffer.Len())
+	app.encoding = enc
+	app.autoEncoding = true
+	app.detectAt = -1
+	if !full && app.buffer.Incoming() != nil {
+		app.detectAt = p.Address()
+		app.detectedLen = app.buffer.Len()
+	}
+}
+
+// redetect guesses the encoding again with the data loaded after the last
+// guess. It returns true when the encoding is changed.
+func (app *Application) redetect() bool {
+	if !app.autoEncoding || app.detectAt < 0 || app.buffer.Len() <= app.detectedLen {
+		return false
+	}
+	// not to scan the sample for every small chunk, wait until the data
+	// double or end.
+	if app.buffer.Incoming() != nil && app.buffer.Len() < 2*app.detectedLen {
+		return false
+	}
+	old := app.encoding.ModeString()
+	app.autoDetect(large.NewPointerAt(app.detectAt, app.buffer))
+	return app.encoding.ModeString() != old
 }
 
 func NewApplication(tty ttyadapter.Tty, in io.Reader, out io.Writer, defaultName string) (*Application, error) {
 	this := &Application{
-		savePath:  defaultName,
-		in:        in,
-		out:       out,
-		buffer:    large.NewBuffer(in),
-		clipBoard: NewClip(),
+		savePath:    defaultName,
+		in:          in,
+		out:         out,
+		buffer:      large.NewBuffer(in),
+		clipBoard:   NewClip(),
+		marks:       map[rune]int64{},
+		maxLineSize: LINE_SIZE,
+		mouse:       "auto",
+		pointerType: pointerType{
+			size:           4,
+			isLittleEndian: true,
+		},
 	}
 	this.window = large.NewPointer(this.buffer)
 	if this.window == nil {
@@ -250,10 +558,16 @@ func NewApplication(tty ttyadapter.Tty, in io.Reader, out io.Writer, defaultName
 	if this.cursor == nil {
 		return nil, io.EOF
 	}
-	this.encoding = detectEncoding(this.cursor)
+	this.autoDetect(this.cursor)
 
 	this.tty1 = tty
-	err := this.tty1.Open(nil)
+	this.resized = make(chan struct{}, 1)
+	err := this.tty1.Open(func(width, height int) {
+		select {
+		case this.resized <- struct{}{}:
+		default: // drawing is already requested
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -262,6 +576,7 @@ func NewApplication(tty ttyadapter.Tty, in io.Reader, out io.Writer, defaultName
 }
 
 func (app *Application) Close() error {
+	app.buffer.Close()
 	io.WriteString(app.out, _ANSI_CURSOR_ON)
 	io.WriteString(app.out, _ANSI_RESET)
 
@@ -271,63 +586,274 @@ func (app *Application) Close() error {
 	return nil
 }
 
+// unicodeName is the name shown instead of the one of the Unicode table.
 var unicodeName = map[rune]string{
 	'\uFEFF': "ByteOrderMark",
 	'\uFFFE': "Reverted ByteOrderMark",
-	'\u200D': "ZeroWidthJoin",
-	'\u202E': "RightToLeftOverride",
-	'\u202D': "LeftToRightOverride",
+}
+
+// generalCategories are the two-letter general categories of Unicode.
+var generalCategories = []string{
+	"Lu", "Ll", "Lt", "Lm", "Lo",
+	"Mn", "Mc", "Me",
+	"Nd", "Nl", "No",
+	"Pc", "Pd", "Ps", "Pe", "Pi", "Pf", "Po",
+	"Sm", "Sc", "Sk", "So",
+	"Zs", "Zl", "Zp",
+	"Cc", "Cf", "Co", "Cs",
+}
+
+func generalCategory(r rune) string {
+	for _, name := range generalCategories {
+		if unicode.Is(unicode.Categories[name], r) {
+			return name
+		}
+	}
+	return "Cn" // unassigned
+}
+
+func runeName(r rune) string {
+	if name, ok := unicodeName[r]; ok {
+		return name
+	}
+	return runenames.Name(r)
 }
 
 func (app *Application) printDefaultStatusBar() {
-	io.WriteString(app.out, _ANSI_YELLOW)
+	var bar strings.Builder
 	if app.dirty {
-		io.WriteString(app.out, "*")
+		bar.WriteString("*")
+	} else {
+		bar.WriteString(" ")
+	}
+	if app.autoEncoding {
+		fmt.Fprintf(&bar, "[%s(auto)]", app.encoding.ModeString())
 	} else {
-		io.WriteString(app.out, " ")
+		fmt.Fprintf(&bar, "[%s]", app.encoding.ModeString())
+	}
+	if app.encoding2 != nil {
+		fmt.Fprintf(&bar, "[+%s]", app.encoding2.ModeString())
+	}
+	if app.byteFormat > 0 && app.bitView == nil {
+		fmt.Fprintf(&bar, "[%s]", byteFormats[app.byteFormat].name)
+	}
+	if app.typing != nil {
+		fmt.Fprintf(&bar, "[%s]", app.typing.ModeString())
+	}
+	if app.bitView != nil {
+		fmt.Fprintf(&bar, "[BIT %d]", 7-app.bitView.bit)
+	}
+	if sel := app.selectedRange(); sel.end > sel.start {
+		fmt.Fprintf(&bar, "[SEL %d]", sel.end-sel.start)
 	}
-	fmt.Fprintf(app.out, "[%s]", app.encoding.ModeString())
 
-	fmt.Fprintf(app.out, "%4[1]d='\\x%02[1]X'", app.cursor.Value())
+	fmt.Fprintf(&bar, "%4[1]d='\\x%02[1]X'", app.cursor.Value())
 
 	theRune, thePosInRune, theLenOfRune := app.encoding.RuneOver(app.cursor.Clone())
 	if theRune != utf8.RuneError {
-		fmt.Fprintf(app.out, "(%d/%d:U+%04X",
+		fmt.Fprintf(&bar, "(%d/%d:U+%04X:%s)",
 			thePosInRune+1,
 			theLenOfRune,
-			theRune)
-		if name, ok := unicodeName[theRune]; ok {
-			fmt.Fprintf(app.out, ":%s", name)
-		}
-		app.out.Write([]byte{')'})
+			theRune,
+			generalCategory(theRune))
 	} else {
-		fmt.Fprintf(app.out, "(bin:'\\x%02X')", app.cursor.Value())
+		fmt.Fprintf(&bar, "(bin:'\\x%02X')", app.cursor.Value())
 	}
 
-	fmt.Fprintf(app.out,
+	fmt.Fprintf(&bar,
 		" @ %[1]d=0x%[1]X/%[2]d=0x%[2]X",
 		app.cursor.Address(),
 		app.buffer.Len())
 
+	if theRune != utf8.RuneError {
+		if name := runeName(theRune); name != "" {
+			fmt.Fprintf(&bar, " %s", name)
+		}
+	}
+
+	status := bar.String()
+	if app.screenWidth > 0 {
+		status = runewidth.Truncate(status, app.screenWidth-1, "")
+	}
+	io.WriteString(app.out, _STATUS_COLOR_ON)
+	io.WriteString(app.out, status)
 	io.WriteString(app.out, _ANSI_ERASE_SCRN_AFTER)
 	io.WriteString(app.out, _ANSI_RESET)
 }
 
 func (app *Application) shiftWindowToSeeCursorLine() {
+	lineSize := int64(app.lineSize())
+	if n := app.window.Address() % lineSize; n > 0 {
+		// the line size has been changed
+		app.window.Rewind(n)
+	}
 	if app.cursor.Address() < app.window.Address() {
 		app.window = app.cursor.Clone()
-		if n := app.window.Address() % LINE_SIZE; n > 0 {
+		if n := app.window.Address() % lineSize; n > 0 {
 			app.window.Rewind(n)
 		}
-	} else if app.cursor.Address() >= app.window.Address()+LINE_SIZE*int64(app.dataHeight()) {
+	} else if app.cursor.Address() >= app.window.Address()+lineSize*int64(app.dataHeight()) {
 		app.window = app.cursor.Clone()
 		app.window.Rewind(
-			app.window.Address()%LINE_SIZE +
-				int64(LINE_SIZE*(app.dataHeight()-1)))
+			app.window.Address()%lineSize +
+				lineSize*int64(app.dataHeight()-1))
+	}
+}
+
+// screen is the state of the terminal which the main loop draws on.
+type screen struct {
+	altScreen     bool
+	width, height int // the size of the last drawing
+	lines         int // from the top of the view to the status line
+}
+
+// draw draws the view and the status bar. The cursor of the terminal is
+// left on the status line.
+func (app *Application) draw(sc *screen) error {
+	app.redetect() // for the data loaded while the prompt was shown
+	var err error
+	app.screenWidth, app.screenHeight, err = app.tty1.Size()
+	if err != nil {
+		return err
+	}
+	if sc.altScreen != app.fullScreen {
+		// The terminal saves the cursor on the inline screen and
+		// restores it on leaving the alternate screen.
+		if app.fullScreen {
+			io.WriteString(app.out, _ANSI_ALT_SCREEN_ON)
+		} else {
+			io.WriteString(app.out, _ANSI_ALT_SCREEN_OFF)
+		}
+		sc.altScreen = app.fullScreen
+		sc.width = 0
+	}
+	if enabled := app.mouseEnabled(); app.mouseOn != enabled {
+		if enabled {
+			io.WriteString(app.out, _ANSI_MOUSE_ON)
+		} else {
+			io.WriteString(app.out, _ANSI_MOUSE_OFF)
+		}
+		app.mouseOn = enabled
+	}
+	if sc.width != app.screenWidth || sc.height != app.screenHeight {
+		app.cache = map[int]string{}
+		sc.width = app.screenWidth
+		sc.height = app.screenHeight
+		io.WriteString(app.out, _ANSI_CURSOR_OFF)
+		app.shiftWindowToSeeCursorLine()
+	}
+	if sc.altScreen {
+		ruler := makeRulerLine(app.currentByteFormat(), app.lineSize(), app.panes())
+		io.WriteString(app.out, _ANSI_CURSOR_HOME)
+		io.WriteString(app.out, _CELL2_COLOR_ON)
+		io.WriteString(app.out, runewidth.Truncate(ruler, app.screenWidth-1, ""))
+		io.WriteString(app.out, _ANSI_ERASE_LINE)
+		io.WriteString(app.out, _CELL2_COLOR_OFF)
+		io.WriteString(app.out, "\r\n")
+	}
+	lf, err := app.View()
+	if err != nil {
+		return err
+	}
+	if app.buffer.Len() <= 0 {
+		return nil
+	}
+	io.WriteString(app.out, "\r\n") // \r is for Linux & go-tty
+	lf++
+	app.viewLines = lf
+	if sc.altScreen {
+		// erase the lines left by the longer view and go to the bottom
+		io.WriteString(app.out, _ANSI_ERASE_SCRN_AFTER)
+		fmt.Fprintf(app.out, "\x1B[%d;1H", app.screenHeight)
+		lf = 0
+	}
+	sc.lines = lf
+	if app.message != "" {
+		io.WriteString(app.out, _STATUS_COLOR_ON)
+		io.WriteString(app.out, runewidth.Truncate(app.message, app.screenWidth-1, ""))
+		io.WriteString(app.out, _ANSI_ERASE_SCRN_AFTER)
+		io.WriteString(app.out, _ANSI_RESET)
+	} else {
+		app.printDefaultStatusBar()
+	}
+	return nil
+}
+
+// rewind moves the cursor of the terminal from the status line to the top
+// of the view to draw it again.
+func (app *Application) rewind(sc *screen) {
+	if sc.lines > 0 {
+		fmt.Fprintf(app.out, "\r\x1B[%dA", sc.lines)
+	} else {
+		io.WriteString(app.out, "\r")
+	}
+}
+
+// restore turns off the modes of the terminal which draw turned on.
+func (app *Application) restore(sc *screen) {
+	app.suspendMouse()
+	if sc.altScreen {
+		io.WriteString(app.out, _ANSI_ALT_SCREEN_OFF+_ANSI_ERASE_SCRN_AFTER)
+	}
+}
+
+// waitKey waits for the key while storing the data read in the background
+// and updating the size on the status bar. When the terminal is resized,
+// it draws the screen again at once. After all data are stored, nothing
+// but the key and resizing wakes it up.
+func (app *Application) waitKey(keyWorker *nonblock.NonBlock, sc *screen) (string, error) {
+	const interval = 10
+	ticker := time.NewTicker(time.Second / interval)
+	defer ticker.Stop()
+	tick := ticker.C
+	keyWorker.Request()
+	for {
+		if app.buffer.Incoming() == nil {
+			tick = nil
+		}
+		select {
+		case res := <-keyWorker.C():
+			return res.Data, res.Err
+		case c := <-app.buffer.Incoming():
+			err := app.buffer.Store(c)
+			if app.redetect() {
+				app.rewind(sc)
+				if err := app.draw(sc); err != nil {
+					return "", err
+				}
+			} else if err != nil && app.message == "" {
+				app.out.Write([]byte{'\r'})
+				app.printDefaultStatusBar()
+			}
+		case <-tick:
+			if app.message == "" {
+				app.out.Write([]byte{'\r'})
+				app.printDefaultStatusBar()
+			}
+		case <-app.resized:
+			// the terminal may have wrapped the old lines
+			app.rewind(sc)
+			io.WriteString(app.out, _ANSI_ERASE_SCRN_AFTER)
+			if err := app.draw(sc); err != nil {
+				return "", err
+			}
+		}
 	}
 }
 
 func mains(args []string) error {
+	conf, err := loadConfig(*flagConfig)
+	if err != nil {
+		return err
+	}
+	themeName := *flagTheme
+	if themeName == "" {
+		themeName = conf.theme
+	}
+	if err := loadTheme(themeName); err != nil {
+		return err
+	}
+
 	disable := colorable.EnableColorsStdout(nil)
 	if disable != nil {
 		defer disable()
@@ -356,83 +882,51 @@ func mains(args []string) error {
 		return err
 	}
 	defer app.Close()
+	if err := conf.apply(app); err != nil {
+		return err
+	}
+	if *flagFullScreen {
+		app.fullScreen = true
+	}
 
 	keyWorker := nonblock.New(func() (string, error) { return app.tty1.GetKey() })
 	defer keyWorker.Close()
 
-	var lastWidth, lastHeight int
+	var sc screen
+	defer app.restore(&sc)
 	for {
-		app.screenWidth, app.screenHeight, err = app.tty1.Size()
-		if err != nil {
-			return err
-		}
-		if lastWidth != app.screenWidth || lastHeight != app.screenHeight {
-			app.cache = map[int]string{}
-			lastWidth = app.screenWidth
-			lastHeight = app.screenHeight
-			io.WriteString(app.out, _ANSI_CURSOR_OFF)
-		}
-		lf, err := app.View()
-		if err != nil {
+		if err := app.draw(&sc); err != nil {
 			return err
 		}
 		if app.buffer.Len() <= 0 {
 			return nil
 		}
-		io.WriteString(app.out, "\r\n") // \r is for Linux & go-tty
-		lf++
-		if app.message != "" {
-			io.WriteString(app.out, _ANSI_YELLOW)
-			io.WriteString(app.out, runewidth.Truncate(app.message, app.screenWidth-1, ""))
-			io.WriteString(app.out, _ANSI_ERASE_SCRN_AFTER)
-			io.WriteString(app.out, _ANSI_RESET)
-		} else {
-			app.printDefaultStatusBar()
-		}
-
-		const interval = 10
-		displayUpdateTime := time.Now().Add(time.Second / interval)
-
-		ch, err := keyWorker.GetOr(func() bool {
-			err := app.buffer.Fetch()
-			if err != nil && err != io.EOF {
-				return false
-			}
-			if app.message != "" {
-				return err == nil
-			}
-			if err == io.EOF || time.Now().After(displayUpdateTime) {
-				app.out.Write([]byte{'\r'})
-				app.printDefaultStatusBar()
-				displayUpdateTime = time.Now().Add(time.Second / interval)
-			}
-			return err == nil
-		})
+		ch, err := app.waitKey(keyWorker, &sc)
 		if err != nil {
 			return err
 		}
 		app.message = ""
-		if hander, ok := jumpTable[ch]; ok {
-			if err := hander(app); err != nil {
-				return err
-			}
+		if err := app.handleKey(ch); err != nil {
+			return err
 		}
 		if app.buffer.Len() <= 0 {
 			return nil
 		}
-
 		app.shiftWindowToSeeCursorLine()
-
-		if lf > 0 {
-			fmt.Fprintf(app.out, "\r\x1B[%dA", lf)
-		} else {
-			io.WriteString(app.out, "\r")
-		}
+		app.rewind(&sc)
 	}
 }
 
+var (
+	flagTheme  = flag.String("theme", "", "the color theme (dark, light, 256, truecolor, mono) or the path of a theme file")
+	flagConfig = flag.String("config", "", "the path of the config file")
+
+	flagFullScreen = flag.Bool("fullscreen", false, "use the whole screen with the alternate screen buffer")
+)
+
 func main() {
-	if err := mains(os.Args[1:]); err != nil && err != io.EOF {
+	flag.Parse()
+	if err := mains(flag.Args()); err != nil && err != io.EOF {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
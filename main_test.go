@@ -1,12 +1,20 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mattn/go-runewidth"
 	"github.com/nyaosorg/go-ttyadapter/auto"
 
+	"github.com/hymkor/binview/internal/encoding"
+	"github.com/hymkor/binview/internal/nonblock"
+
 	. "github.com/hymkor/binview/internal/large"
 )
 
@@ -22,6 +30,17 @@ func _append(exp string) func(*Application) error {
 	}
 }
 
+func _keys(keys ...string) func(*Application) error {
+	return func(app *Application) error {
+		for _, key := range keys {
+			if err := app.handleKey(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func try(
 	t *testing.T,
 	source string,
@@ -29,19 +48,10 @@ func try(
 	funcs ...func(app *Application) error) {
 
 	ALLOC_SIZE = 4
-	app, err := NewApplication(
-		&auto.Pilot{Text: []string{}},
-		strings.NewReader(source),
-		io.Discard,
-		"dummy")
-	if err != nil {
-		t.Fatal(err.Error())
-		return
-	}
+	app := newTestApp(t, source)
 
 	for _, f := range funcs {
 		if err := f(app); err != nil {
-			app.Close()
 			t.Fatal(err.Error())
 			return
 		}
@@ -49,12 +59,27 @@ func try(
 
 	var output strings.Builder
 	app.buffer.WriteTo(&output)
-	app.Close()
 	if outputStr := output.String(); outputStr != expect {
 		t.Fatalf("expect '%s' but '%s'", expect, outputStr)
 	}
 }
 
+// newTestApp makes the application for the source with the keys to be
+// typed, which is closed at the end of the test.
+func newTestApp(t *testing.T, source string, keys ...string) *Application {
+	t.Helper()
+	app, err := NewApplication(
+		&auto.Pilot{Text: keys},
+		strings.NewReader(source),
+		io.Discard,
+		"dummy")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { app.Close() })
+	return app
+}
+
 func TestNoModify(t *testing.T) {
 	const sample = "1234567890"
 	try(t, sample, sample)
@@ -165,3 +190,834 @@ func TestAppendAndUndo(t *testing.T) {
 		_append(`"abcdef"`),
 		keyFuncUndo)
 }
+
+func TestEvalAddress(t *testing.T) {
+	ALLOC_SIZE = 4
+	source := strings.Repeat("\x00", 0x3C) + "\x80\x00\x00\x00" + strings.Repeat("\xFF", 0x80)
+	app := newTestApp(t, source)
+	app.cursor.Skip(0x10)
+	app.marks['a'] = 0x20
+
+	tests := []struct {
+		exp    string
+		expect int64
+	}{
+		{"0x100", 0x100},
+		{"+0x200", 0x210},
+		{"-16", 0},
+		{"0x3C + 4*2", 0x44},
+		{"(1+2)*3", 9},
+		{"$", int64(len(source) - 1)},
+		{"$-0x10", int64(len(source) - 0x11)},
+		{"'a+1", 0x21},
+		{"*u32le(0x3C)", 0x80},
+		{"*u32be(0x3C)", 0x80000000},
+		{"*u8 0x3C + 4", 0x84},
+		{"*i8($)", -1},
+	}
+	for _, tt := range tests {
+		result, err := evalAddress(tt.exp, app)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.exp, err.Error())
+		}
+		if result != tt.expect {
+			t.Fatalf("%s: expect 0x%X but 0x%X", tt.exp, tt.expect, result)
+		}
+	}
+	for _, exp := range []string{"0x10 +", "*u32", "'b", "1/0", "(1", "*u32le($)"} {
+		if _, err := evalAddress(exp, app); err == nil {
+			t.Fatalf("%s: expect error but no error", exp)
+		}
+	}
+}
+
+func TestFollowPointerAndReturn(t *testing.T) {
+	try(t, "\x06\x00\x00\x00\xFFABCDEFGH", "\x00\x00\x00\xFFACDEFGH",
+		keyFuncFollowPointer,
+		keyFuncRemoveByte,
+		keyFuncReturnFromPointer,
+		keyFuncRemoveByte)
+}
+
+func TestReplaceMode(t *testing.T) {
+	try(t, "0123", "AB23",
+		_keys("R", "4", "1", "4", "2", "\x1B"))
+}
+
+func TestReplaceModeBackspace(t *testing.T) {
+	try(t, "0123", "A423",
+		_keys("R", "4", "1", "4", "2", "\b", "\x7F", "3", "4", "\x1B"))
+}
+
+func TestReplaceModeAndUndo(t *testing.T) {
+	try(t, "0123", "0123",
+		_keys("R", "4", "1", "l", "4", "2", "\x1B", "u"))
+}
+
+func TestReplaceModeEnter(t *testing.T) {
+	// ENTER ends the mode instead of following the pointer
+	try(t, "0123", "A123",
+		_keys("R", "4", "1", "\r"),
+		func(app *Application) error {
+			if app.typing != nil || app.cursor.Address() != 1 {
+				return fmt.Errorf("the mode is not ended at 1: %d", app.cursor.Address())
+			}
+			return nil
+		})
+	try(t, "abc", "abc",
+		_keys("\t", "x", "y", "\r", "u"))
+}
+
+func TestTextMode(t *testing.T) {
+	try(t, "abc", "Xあc",
+		_keys("\t", "X", "あ", "\x1B"))
+}
+
+func TestTextModeReplaceMultiByteRune(t *testing.T) {
+	try(t, "あい", "xい",
+		keyFuncForward,
+		_keys("\t", "x", "\x1B"))
+}
+
+func TestTextModeInsertAndAppend(t *testing.T) {
+	try(t, "ab", "xaYZ",
+		_keys("\t", _KEY_INSERT, "x", _KEY_INSERT, "a", "Y", "Z", "\x1B"))
+}
+
+func TestTextModeUTF16(t *testing.T) {
+	try(t, "a\x00b\x00", "Z\x00b\x00",
+		keyFuncUtf16LeMode,
+		keyFuncForward,
+		_keys("\t", "Z", "\x1B"))
+}
+
+func TestTextModeBackspaceAndUndo(t *testing.T) {
+	try(t, "abc", "abc",
+		_keys("\t", "あ", "y", "\x7F", "\x1B", "u"))
+	try(t, "abc", "あbc",
+		_keys("\t", "あ", "y", "\x7F", "\x1B"))
+}
+
+func TestHexInsertMode(t *testing.T) {
+	try(t, "0123", "0\x12\x34\x56123",
+		keyFuncForward,
+		_keys("I", "1", "2", "3", "4", "5", "6", "\x1B"))
+}
+
+func TestHexInsertModeBackspaceAndUndo(t *testing.T) {
+	try(t, "0123", "0\x12\x3F123",
+		keyFuncForward,
+		_keys("I", "1", "2", "3", "4", "\b", "F", "5", "\b", "\x1B"))
+	try(t, "0123", "0123",
+		keyFuncForward,
+		_keys("I", "1", "2", "3", "4", "\x1B", "u"))
+}
+
+func TestDetectEncoding(t *testing.T) {
+	for source, expect := range map[string]string{
+		"\xFF\xFE\x00\x00a\x00\x00\x00": "32LE",
+		"\x00\x00\xFE\xFF\x00\x00\x00a": "32BE",
+		"\xFF\xFEa\x00":                 "16LE",
+		"\xFE\xFF\x00a":                 "16BE",
+		"abc":                           "UTF8",
+		"\x93\xFA\x96\x7B\x8C\xEA\x82\xF0\x8F\x91\x82\xAB\x82\xDC\x82\xB7\r\n": "SJIS",
+	} {
+		app := newTestApp(t, source)
+		if mode := app.encoding.ModeString(); mode != expect {
+			t.Fatalf("%q: expect %s but %s", source, expect, mode)
+		}
+	}
+}
+
+func TestDetectEncodingOnSlowPipe(t *testing.T) {
+	r, w := io.Pipe()
+	release := make(chan struct{})
+	go func() {
+		io.WriteString(w, "abcde")
+		<-release
+		io.WriteString(w, "\x93\xFA\x96\x7B\x8C\xEA\x82\xF0\x8F\x91\x82\xAB\x82\xDC\x82\xB7\r\n")
+		w.Close()
+	}()
+	start := time.Now()
+	app, err := NewApplication(&auto.Pilot{Text: []string{}}, r, io.Discard, "dummy")
+	close(release)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { app.Close() })
+	if d := time.Since(start); d > time.Second/2 {
+		t.Fatalf("the detection waited for the data: %v", d)
+	}
+	if mode := app.encoding.ModeString(); mode != "UTF8" {
+		t.Fatalf("expect UTF8 but %s", mode)
+	}
+	for app.buffer.Fetch() == nil {
+	}
+	if !app.redetect() || app.encoding.ModeString() != "SJIS" {
+		t.Fatalf("not detected again with the rest: %s", app.encoding.ModeString())
+	}
+	if app.redetect() {
+		t.Fatal("detected again after the end of the data")
+	}
+}
+
+func TestSelectEncoding(t *testing.T) {
+	app := newTestApp(t, "abc", "l", "k", "c", "c", "\r")
+	app.screenWidth = 80
+	keyFuncSelectEncoding(app)
+	if mode := app.encoding.ModeString(); mode != "CP850" {
+		t.Fatalf("expect CP850 but %s", mode)
+	}
+}
+
+func TestStatusBar(t *testing.T) {
+	var out strings.Builder
+	app := newTestApp(t, "\xE3\x81\x82")
+	app.out = &out
+	app.screenWidth = 80
+	app.cursor.Next()
+	app.printDefaultStatusBar()
+	if s := out.String(); !strings.Contains(s, "(2/3:U+3042:Lo)") || !strings.Contains(s, "HIRAGANA LETTER A") {
+		t.Fatalf("unexpected status bar: %q", s)
+	}
+
+	out.Reset()
+	app.screenWidth = 20
+	app.printDefaultStatusBar()
+	if s := out.String(); strings.Contains(s, "HIRAGANA") {
+		t.Fatalf("status bar is not truncated: %q", s)
+	}
+}
+
+func TestGeneralCategory(t *testing.T) {
+	for r, expect := range map[rune]string{
+		'A':          "Lu",
+		'a':          "Ll",
+		'あ':          "Lo",
+		'1':          "Nd",
+		' ':          "Zs",
+		'\n':         "Cc",
+		'\u200D':     "Cf",
+		'\u0301':     "Mn",
+		'\U000E0080': "Cn",
+	} {
+		if c := generalCategory(r); c != expect {
+			t.Fatalf("%U: expect %s but %s", r, expect, c)
+		}
+	}
+}
+
+func TestNextInvalid(t *testing.T) {
+	app := newTestApp(t, "a.\xE3\x81\x82\xC0\xAFb\x80")
+	app.setEncoding(encoding.UTF8Encoding{})
+	for _, expect := range []int64{5, 8, 8} {
+		keyFuncNextInvalid(app)
+		if a := app.cursor.Address(); a != expect {
+			t.Fatalf("expect %d but %d (%s)", expect, a, app.message)
+		}
+	}
+}
+
+func TestInvalidView(t *testing.T) {
+	var out strings.Builder
+	app := newTestApp(t, ".\x80\xC0\xAF\xED\xA0\x80")
+	makeAsciiPart(encoding.UTF8Encoding{}, app.window.Clone(), -1, LINE_SIZE, &out)
+	for _, expect := range []string{
+		classColor(classPrintable, false) + ".",
+		_INVALID_COLOR_ON + "C",
+		_FORBIDDEN_COLOR_ON + "OO",
+		_FORBIDDEN_COLOR_ON + "SSS",
+	} {
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("%q not in %q", expect, out.String())
+		}
+	}
+}
+
+func TestRuneOverLines(t *testing.T) {
+	app := newTestApp(t, strings.Repeat("a", 15)+"\xE3\x81\x82b")
+	app.setEncoding(encoding.UTF8Encoding{})
+	var out strings.Builder
+	line := NewPointerAt(LINE_SIZE, app.buffer)
+	makeAsciiPart(app.encoding, line, -1, LINE_SIZE, &out)
+	if s := out.String(); !strings.HasPrefix(s, "  ") || strings.Contains(s, "C") {
+		t.Fatalf("the rest of the character is not blank: %q", s)
+	}
+}
+
+var rxAnsiEscape = regexp.MustCompile("\x1B\\[[0-9;]*[a-zA-Z]")
+
+func TestInvalidOverLines(t *testing.T) {
+	app := newTestApp(t, strings.Repeat("a", 15)+"\xED\xA0\x80b")
+	app.setEncoding(encoding.UTF8Encoding{})
+	for i, expect := range []string{
+		strings.Repeat("a", 15) + "S",
+		"  b" + strings.Repeat(" ", LINE_SIZE-3),
+	} {
+		var out strings.Builder
+		makeAsciiPart(app.encoding, NewPointerAt(int64(i*LINE_SIZE), app.buffer), -1, LINE_SIZE, &out)
+		if text := rxAnsiEscape.ReplaceAllString(out.String(), ""); text != expect {
+			t.Fatalf("line %d: expect %q but %q", i, expect, text)
+		}
+	}
+}
+
+func TestAsciiPartAlignment(t *testing.T) {
+	source := "a\u00E9\u6F22\u200B\u0301\U0001F600\u202E\uFE0F" + strings.Repeat("b", 16)
+	app := newTestApp(t, source)
+	app.setEncoding(encoding.UTF8Encoding{})
+	var all strings.Builder
+	for address := int64(0); address < int64(len(source)); address += LINE_SIZE {
+		var out strings.Builder
+		makeAsciiPart(app.encoding, NewPointerAt(address, app.buffer), -1, LINE_SIZE, &out)
+		text := rxAnsiEscape.ReplaceAllString(out.String(), "")
+		if address+LINE_SIZE <= int64(len(source)) && runewidth.StringWidth(text) != LINE_SIZE {
+			t.Fatalf("0x%X: the width of %q is not %d", address, text, LINE_SIZE)
+		}
+		all.WriteString(text)
+	}
+	for _, placeholder := range []string{"_", "\u25CC\u0301", "<", "v"} {
+		if !strings.Contains(all.String(), placeholder) {
+			t.Fatalf("%q not in %q", placeholder, all.String())
+		}
+	}
+}
+
+func TestWideCharAtLineEnd(t *testing.T) {
+	for _, enc := range []encoding.Encoding{encoding.UTF8Encoding{}, encoding.ShiftJIS()} {
+		wide := "\u6F22"
+		if enc.ModeString() == "SJIS" {
+			wide = "\x8A\xBF"
+		}
+		app := newTestApp(t, strings.Repeat("a", 15)+wide+"b")
+		app.setEncoding(enc)
+		for i, expect := range []string{strings.Repeat("a", 15) + "+", "b"} {
+			var out strings.Builder
+			makeAsciiPart(enc, NewPointerAt(int64(i*LINE_SIZE), app.buffer), -1, LINE_SIZE, &out)
+			text := rxAnsiEscape.ReplaceAllString(out.String(), "")
+			if runewidth.StringWidth(text) != LINE_SIZE || strings.TrimSpace(text) != expect {
+				t.Fatalf("%s: line %d: %q is not %q in %d columns", enc.ModeString(), i, text, expect, LINE_SIZE)
+			}
+		}
+	}
+}
+
+func TestSelectEncoding2(t *testing.T) {
+	app := newTestApp(t, "\x82\xA0", "c", "\r", "(", "\r")
+	app.screenWidth = 80
+	keyFuncSelectEncoding2(app)
+	if app.encoding2 == nil || app.encoding2.ModeString() != "CP437" {
+		t.Fatal("the second encoding is not CP437")
+	}
+	if n := app.lineSize(); n != 8 {
+		t.Fatalf("expect 8 bytes per line on the narrow screen, but %d", n)
+	}
+	line, _ := makeLineImage(encoding.ShiftJIS(), app.encoding2, app.window.Clone(), -1, cursorOnBoth, byteFormats[0], LINE_SIZE, selRange{})
+	if !strings.Contains(line, "あ") || !strings.Contains(line, "é") {
+		t.Fatalf("both of the encodings are not shown: %q", line)
+	}
+	keyFuncSelectEncoding2(app)
+	if app.encoding2 != nil {
+		t.Fatal("the second encoding is not hidden")
+	}
+}
+
+func TestByteFormats(t *testing.T) {
+	app := newTestApp(t, strings.Repeat("\x05", 64))
+	app.screenWidth = 80
+	for _, tt := range []struct {
+		cell     string
+		lineSize int
+	}{
+		{"05", 16},
+		{"005", 8},
+		{"  5", 8},
+		{"00000101", 4},
+	} {
+		if n := app.lineSize(); n != tt.lineSize {
+			t.Fatalf("%s: expect %d bytes per line but %d", byteFormats[app.byteFormat].name, tt.lineSize, n)
+		}
+		line, _ := makeLineImage(app.encoding, nil, app.window.Clone(), -1, cursorOnBoth, byteFormats[app.byteFormat], app.lineSize(), selRange{})
+		text := rxAnsiEscape.ReplaceAllString(line, "")
+		if w := runewidth.StringWidth(text); w >= app.screenWidth || !strings.Contains(text, tt.cell) {
+			t.Fatalf("%s: unexpected line %q", byteFormats[app.byteFormat].name, text)
+		}
+		keyFuncCycleByteFormat(app)
+	}
+
+	keyFuncGoEndOfLine(app)
+	keyFuncNext(app)
+	if a := app.cursor.Address(); a != LINE_SIZE*2-1 {
+		t.Fatalf("expect 0x%X but 0x%X", LINE_SIZE*2-1, a)
+	}
+	app.byteFormat = 3
+	keyFuncGoBeginOfLine(app)
+	if a := app.cursor.Address(); a != LINE_SIZE*2-4 {
+		t.Fatalf("expect 0x%X but 0x%X", LINE_SIZE*2-4, a)
+	}
+}
+
+func TestBitView(t *testing.T) {
+	try(t, "\x00\x00", "\xC1\x00",
+		_keys("b", " ", "l", "1", "l", "l", "l", "l", "l", "l", "1", "u", "h", "h", "1", _KEY_ESC))
+	try(t, "\x0F", "\x0F",
+		_keys("b", "0", "0", "0", "0", "0", "u", "u", "u", "u", "u", _KEY_ESC))
+	try(t, "\x00", "\x40",
+		_keys("b", "l", "l", _KEY_DEL_ASCII, "1", _KEY_ESC))
+}
+
+func TestBitViewCursor(t *testing.T) {
+	app := newTestApp(t, "\x05")
+	_keys("b", "l", "l", "l", "l", "l")(app)
+	line, _ := makeLineImage(app.encoding, nil, app.window.Clone(), app.cursor.Address(), app.cursorMode(), app.currentByteFormat(), app.lineSize(), selRange{})
+	if !strings.Contains(line, "00000"+_CURSOR_COLOR_ON+"1"+_CURSOR_COLOR_OFF+"01") {
+		t.Fatalf("the bit under the cursor is not highlighted: %q", line)
+	}
+}
+
+func TestByteClass(t *testing.T) {
+	for b, expect := range map[byte]byteClass{
+		0x00: classNull,
+		0xFF: classFF,
+		'A':  classPrintable,
+		' ':  classWhitespace,
+		'\n': classWhitespace,
+		0x1B: classControl,
+		0x7F: classControl,
+		0x80: classHigh,
+	} {
+		if c := classOfByte(b); c != expect {
+			t.Fatalf("0x%02X: expect %d but %d", b, expect, c)
+		}
+	}
+
+	app := newTestApp(t, "\x00A\nZ\xFF")
+	app.setEncoding(encoding.UTF8Encoding{})
+	line, _ := makeLineImage(app.encoding, nil, app.window.Clone(), -1, cursorOnBoth, byteFormats[0], LINE_SIZE, selRange{})
+	for _, expect := range []string{
+		classColor(classNull, false) + "00",
+		classColor(classPrintable, false) + "41",
+		classColor(classFF, true) + "FF",
+		classColor(classPrintable, false) + "A",
+		classColor(classWhitespace, false) + string(_HALFWIDTH_DOWNWARDS_ARROW),
+	} {
+		if !strings.Contains(line, expect) {
+			t.Fatalf("%q not in %q", expect, line)
+		}
+	}
+}
+
+func TestTheme(t *testing.T) {
+	defer applyTheme(themes[defaultThemeName])
+
+	t.Setenv("NO_COLOR", "1")
+	if err := loadTheme(""); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _CURSOR_COLOR_ON != "\x1B[7m" || classColor(classPrintable, true) != "" {
+		t.Fatalf("NO_COLOR is not honoured: %q", _CURSOR_COLOR_ON)
+	}
+	if err := loadTheme("256"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if classColor(classHigh, false) != "\x1B[38;5;214;48;5;234;22m" {
+		t.Fatalf("unexpected color: %q", classColor(classHigh, false))
+	}
+
+	th, err := readTheme(strings.NewReader("# comment\nbase = light\nhigh = 38;2;1;2;3\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if th.class[classHigh] != "38;2;1;2;3" || th.background != themes["light"].background {
+		t.Fatalf("unexpected theme: %v", th)
+	}
+	if _, err := readTheme(strings.NewReader("foo = 1\n")); err == nil {
+		t.Fatal("the unknown key is not an error")
+	}
+}
+
+func TestCommandNames(t *testing.T) {
+	for key, name := range jumpTable {
+		if _, ok := lookupCommand(name); !ok {
+			t.Fatalf("%q: %s: no such command", key, name)
+		}
+	}
+	names := map[string]bool{}
+	for _, c := range commands {
+		if names[c.name] {
+			t.Fatalf("%s: duplicated", c.name)
+		}
+		names[c.name] = true
+	}
+}
+
+func TestParseKeyName(t *testing.T) {
+	for name, expect := range map[string]string{
+		"x":      "x",
+		"C-a":    "\x01",
+		"c-]":    "\x1D",
+		"M-x":    "\x1Bx",
+		"enter":  "\r",
+		"SPACE":  " ",
+		"Delete": _KEY_DEL,
+	} {
+		key, err := parseKeyName(name)
+		if err != nil || key != expect {
+			t.Fatalf("%s: expect %q but %q (%v)", name, expect, key, err)
+		}
+	}
+	if _, err := parseKeyName("C-1"); err == nil {
+		t.Fatal("C-1 is not an error")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	orgTable := map[string]string{}
+	for key, name := range jumpTable {
+		orgTable[key] = name
+	}
+	defer func() { jumpTable = orgTable }()
+
+	conf, err := readConfig(strings.NewReader(`# comment
+encoding = Shift_JIS
+width = 8
+format = oct
+pointer = u16be
+bind C-d = next-line
+bind x = none
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	app := newTestApp(t, strings.Repeat("a", 32))
+	app.buffer.ReadAll()
+	if err := conf.apply(app); err != nil {
+		t.Fatal(err.Error())
+	}
+	if app.encoding.ModeString() != "SJIS" || app.byteFormat != 1 || app.pointerType.size != 2 || app.pointerType.isLittleEndian {
+		t.Fatal("the settings are not applied")
+	}
+	_keys("\x04", "x")(app)
+	if a := app.cursor.Address(); a != 8 || app.buffer.Len() != 32 {
+		t.Fatalf("the bindings are not applied: 0x%X, %d", a, app.buffer.Len())
+	}
+
+	for _, source := range []string{
+		"bind q = no-such-command\n",
+		"encoding = no-such-encoding\n",
+		"width = 0\n",
+		"foo = bar\n",
+		"bind C-1 = quit\n",
+	} {
+		if _, err := readConfig(strings.NewReader(source)); err == nil {
+			t.Fatalf("%q: no error", source)
+		} else if !strings.Contains(err.Error(), "line 1:") {
+			t.Fatalf("%q: the line number is not shown: %s", source, err.Error())
+		}
+	}
+}
+
+func _ex(line string) func(*Application) error {
+	return func(app *Application) error {
+		app.message = ""
+		if err := app.execute(line); err != nil {
+			return err
+		}
+		if app.message != "" {
+			return errors.New(app.message)
+		}
+		return nil
+	}
+}
+
+func TestExCommand(t *testing.T) {
+	try(t, "0123456789", "01\x00\x00\x00\x00\x00\x00\x00\x00",
+		_ex("goto 2"), _ex("fill 0x00 8"))
+	try(t, "0123456789", "0123\xFF\xFF6789",
+		_ex("goto 0x4"), _ex("fill 255 2"))
+	try(t, "0123456789", "0123456789",
+		_ex("fill 0 5"), _ex("undo"))
+	try(t, "0123456789", "ABC0123456789",
+		_ex("insert-data \"ABC\""))
+	try(t, "0123456789", "0123456789",
+		func(app *Application) error {
+			if _ex("set width=8 format=dec")(app) != nil || app.maxLineSize != 8 || app.byteFormat != 2 {
+				return errors.New("set does not work")
+			}
+			if _ex("enc sjis")(app) != nil || app.encoding.ModeString() != "SJIS" {
+				return errors.New("enc does not work")
+			}
+			for _, line := range []string{"no-such-command", "fill", "fill 0x100", "set width", "undo 1"} {
+				if _ex(line)(app) == nil {
+					return fmt.Errorf("%q: no error", line)
+				}
+			}
+			if err := _ex("q!")(app); err != io.EOF {
+				return fmt.Errorf("q!: %v", err)
+			}
+			return nil
+		})
+}
+
+func TestExCommandNames(t *testing.T) {
+	names := exCommandNames()
+	for name, fullName := range exAliases {
+		if _, ok := lookupCommand(fullName); !ok {
+			t.Fatalf("%s: %s: no such command", name, fullName)
+		}
+	}
+	for name := range exFuncs {
+		if _, ok := lookupCommand(name); !ok {
+			t.Fatalf("%s: no such command", name)
+		}
+	}
+	if len(names) != len(commands)+len(exAliases) {
+		t.Fatal("the names are not listed")
+	}
+}
+
+func TestHelp(t *testing.T) {
+	for key := range jumpTable {
+		name := keyDisplayName(key)
+		if k, err := parseKeyName(name); err != nil || k != key {
+			t.Fatalf("%q: %s can not be parsed", key, name)
+		}
+	}
+	known := map[string]bool{}
+	for _, category := range categories {
+		known[category] = true
+	}
+	var help strings.Builder
+	for _, line := range makeHelpLines() {
+		help.WriteString(line.text)
+		help.WriteByte('\n')
+	}
+	text := help.String()
+	for _, c := range commands {
+		if !known[c.category] {
+			t.Fatalf("%s: unknown category %q", c.name, c.category)
+		}
+		if !strings.Contains(text, c.help) {
+			t.Fatalf("%s: not in the help", c.name)
+		}
+	}
+	if !strings.Contains(text, "C-n DOWN") || !strings.Contains(text, ":force-quit") {
+		t.Fatalf("the keys are not listed:\n%s", text)
+	}
+
+	try(t, "0123456789", "0123456789",
+		func(app *Application) error {
+			app.screenHeight = 5
+			_keys("?", "j", "j", "x")(app)
+			if app.help == nil || app.help.top != 2 {
+				return errors.New("the help is not scrolled")
+			}
+			app.cache = map[int]string{}
+			app.View()
+			_keys("q")(app)
+			if app.help != nil {
+				return errors.New("the help is not closed")
+			}
+			return nil
+		})
+}
+
+func TestFullScreen(t *testing.T) {
+	if ruler := makeRulerLine(byteFormats[0], 4, 2); ruler != "  Offset 00 01 02 03 0123 0123" {
+		t.Fatalf("ruler: %q", ruler)
+	}
+	if ruler := makeRulerLine(byteFormats[2], 2, 1); ruler != "  Offset   0   1 01" {
+		t.Fatalf("ruler: %q", ruler)
+	}
+	try(t, "0123456789", "0123456789",
+		func(app *Application) error {
+			app.screenHeight = 10
+			if err := app.setOption("screen", "full"); err != nil {
+				return err
+			}
+			if !app.fullScreen || app.dataHeight() != 8 {
+				return errors.New("the full-screen mode is not set")
+			}
+			if err := app.setOption("screen", "inline"); err != nil {
+				return err
+			}
+			if app.fullScreen || app.dataHeight() != 9 {
+				return errors.New("the inline mode is not set")
+			}
+			return nil
+		})
+}
+
+func TestMouse(t *testing.T) {
+	events, row, ok := parseTerminalReports("\x1B[<0;12;3M\x1B[<32;14;3M\x1B[5;1R")
+	if !ok || len(events) != 2 || row != 5 || events[1] != (mouseEvent{button: 32, x: 14, y: 3}) {
+		t.Fatalf("%v %d %v", events, row, ok)
+	}
+	for _, key := range []string{"\x1B", "\x1B[A", "\x1B[<0;1M", "q"} {
+		if _, _, ok := parseTerminalReports(key); ok {
+			t.Fatalf("%q: parsed as a report", key)
+		}
+	}
+
+	source := strings.Repeat("0123456789ABCDEF", 8)
+	try(t, source, source, func(app *Application) error {
+		app.buffer.ReadAll()
+		app.screenWidth = 80
+		app.screenHeight = 4
+		app.fullScreen = true
+		// the second line (the row 3) at the column of the third byte
+		_keys("\x1B[<0;16;3M")(app)
+		if a := app.cursor.Address(); a != 0x12 {
+			return fmt.Errorf("click on the hex part: 0x%X", a)
+		}
+		// the character part starts at 9+16*3
+		_keys("\x1B[<0;72;2M", "\x1B[<32;67;3M", "\x1B[<0;67;3m")(app)
+		if sel := app.selectedRange(); app.cursor.Address() != 0x19 || sel != (selRange{start: 0x0E, end: 0x1A}) {
+			return fmt.Errorf("drag: 0x%X %v", app.cursor.Address(), sel)
+		}
+		if _ex("fill 0x2E")(app) != nil || app.selection != nil {
+			return errors.New("fill does not clear the selection")
+		}
+		var data strings.Builder
+		app.buffer.WriteTo(&data)
+		if !strings.HasPrefix(data.String(), "0123456789ABCD............ABCDEF") {
+			return fmt.Errorf("fill the selection: %s", data.String())
+		}
+		_keys("u")(app)
+
+		_keys("\x1B[<65;1;2M")(app)
+		if app.window.Address() != 0x30 || app.cursor.Address() != 0x39 {
+			return fmt.Errorf("wheel: 0x%X 0x%X", app.window.Address(), app.cursor.Address())
+		}
+		_keys("\x1B[<64;1;2M", "\x1B[<64;1;2M")(app)
+		if app.window.Address() != 0 || app.cursor.Address() != 0x19 {
+			return fmt.Errorf("wheel: 0x%X 0x%X", app.window.Address(), app.cursor.Address())
+		}
+
+		// the inline screen waits for the cursor position report
+		app.fullScreen = false
+		app.viewLines = 3
+		_keys("\x1B[<0;10;11M")(app)
+		if app.pendingMouse == nil || app.cursor.Address() != 0x19 {
+			return errors.New("the report does not wait")
+		}
+		_keys("\x1B[13;1R")(app)
+		if app.pendingMouse != nil || app.cursor.Address() != 0x10 {
+			return fmt.Errorf("the report is not processed: 0x%X", app.cursor.Address())
+		}
+		if _keys("\x1B")(app) != nil {
+			return errors.New("a bare ESC was parsed as a mouse report")
+		}
+		return nil
+	})
+}
+
+func TestMouseMode(t *testing.T) {
+	app := newTestApp(t, "abc")
+	var out strings.Builder
+	app.out = &out
+	if app.mouseEnabled() {
+		t.Fatal("the mouse is used in the inline mode by default")
+	}
+	app.fullScreen = true
+	if !app.mouseEnabled() {
+		t.Fatal("the mouse is not used in the full-screen mode by default")
+	}
+	if app.setOption("mouse", "off") != nil || app.mouseEnabled() {
+		t.Fatal("mouse=off is not applied")
+	}
+	app.fullScreen = false
+	if app.setOption("mouse", "on") != nil || !app.mouseEnabled() {
+		t.Fatal("mouse=on is not applied")
+	}
+
+	// the reports are turned off while a command may prompt
+	app.mouseOn = true
+	app.handleKey("\x1B[<64;1;2M")
+	if !app.mouseOn {
+		t.Fatal("the mouse report turned off the reports")
+	}
+	app.handleKey("l")
+	if app.mouseOn || !strings.Contains(out.String(), _ANSI_MOUSE_OFF) {
+		t.Fatal("the reports are not turned off for the command")
+	}
+}
+
+func TestMouseWhileTyping(t *testing.T) {
+	clickAt := func(x int) func(*Application) error {
+		return func(app *Application) error {
+			app.screenWidth = 80
+			app.screenHeight = 4
+			app.fullScreen = true
+			return _keys(fmt.Sprintf("\x1B[<0;%d;2M", x))(app)
+		}
+	}
+	// the text typed at the end is not appended after the click
+	try(t, "ab", "xY", _keys("l", "\t", "Y"), clickAt(10), _keys("x", "\x1B"))
+	// the half-typed byte is not continued on the clicked byte
+	try(t, "ab", "Ac", _keys("R", "4"), clickAt(13), _keys("6", "3", "\x1B"))
+}
+
+func TestWaitKey(t *testing.T) {
+	source := strings.Repeat("0123456789", 100)
+	try(t, source, source, func(app *Application) error {
+		release := make(chan struct{})
+		keyWorker := nonblock.New(func() (string, error) {
+			<-release
+			return "j", nil
+		})
+		defer keyWorker.Close()
+		go func() {
+			time.Sleep(time.Second / 5)
+			close(release)
+		}()
+		key, err := app.waitKey(keyWorker, &screen{})
+		if err != nil || key != "j" {
+			return fmt.Errorf("%q %v", key, err)
+		}
+		if app.buffer.Incoming() != nil || app.buffer.Len() != int64(len(source)) {
+			return fmt.Errorf("the data are not loaded while waiting: %d", app.buffer.Len())
+		}
+		return nil
+	})
+}
+
+func TestResize(t *testing.T) {
+	source := strings.Repeat("0123456789", 100)
+	try(t, source, source, func(app *Application) error {
+		pilot := app.tty1.(*auto.Pilot)
+		var sc screen
+		if err := app.draw(&sc); err != nil {
+			return err
+		}
+		gotoAddress(app, 0x150)
+		app.shiftWindowToSeeCursorLine()
+		if err := app.draw(&sc); err != nil {
+			return err
+		}
+		pilot.Height = 5
+		app.resized <- struct{}{}
+		release := make(chan struct{})
+		keyWorker := nonblock.New(func() (string, error) {
+			<-release
+			return "j", nil
+		})
+		defer keyWorker.Close()
+		go func() {
+			time.Sleep(time.Second / 5)
+			close(release)
+		}()
+		if _, err := app.waitKey(keyWorker, &sc); err != nil {
+			return err
+		}
+		if sc.height != 5 || len(app.cache) > app.dataHeight() {
+			return fmt.Errorf("not redrawn: %d %d", sc.height, len(app.cache))
+		}
+		lineSize := int64(app.lineSize())
+		top := app.window.Address()
+		if cur := app.cursor.Address(); cur < top || cur >= top+lineSize*int64(app.dataHeight()) {
+			return fmt.Errorf("the cursor 0x%X is out of the window 0x%X", cur, top)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	_ANSI_MOUSE_ON      = "\x1B[?1002h\x1B[?1006h" // button events and drags in SGR
+	_ANSI_MOUSE_OFF     = "\x1B[?1006l\x1B[?1002l"
+	_ANSI_REPORT_CURSOR = "\x1B[6n"
+)
+
+// the buttons of the SGR mouse reports
+const (
+	mouseLeft      = 0
+	mouseMotion    = 32 // added while dragging
+	mouseWheelUp   = 64
+	mouseWheelDown = 65
+	mouseModifiers = 4 | 8 | 16 // Shift, Meta and Control
+)
+
+// wheelLines is how many lines one notch of the wheel scrolls.
+const wheelLines = 3
+
+// mouseEvent is a mouse report of xterm in the SGR mode
+// (`ESC [ < BUTTON ; X ; Y M` or `m` on release).
+type mouseEvent struct {
+	button  int
+	x, y    int // 1-origin
+	release bool
+}
+
+var rxTerminalReport = regexp.MustCompile(`^\x1B\[(?:<(\d+);(\d+);(\d+)([Mm])|(\d+);(\d+)R)`)
+
+// parseTerminalReports parses the key read from the terminal as mouse
+// reports and cursor position reports. The terminal may send them in one
+// key. row is the row of the last cursor position report (0: none).
+// ok is false when the key is not made of them (e.g. ESC, cursor keys).
+func parseTerminalReports(key string) (events []mouseEvent, row int, ok bool) {
+	if !strings.HasPrefix(key, "\x1B[") {
+		return nil, 0, false
+	}
+	for key != "" {
+		m := rxTerminalReport.FindStringSubmatch(key)
+		if m == nil {
+			return nil, 0, false
+		}
+		key = key[len(m[0]):]
+		if m[4] != "" {
+			button, _ := strconv.Atoi(m[1])
+			x, _ := strconv.Atoi(m[2])
+			y, _ := strconv.Atoi(m[3])
+			events = append(events, mouseEvent{button: button, x: x, y: y, release: m[4] == "m"})
+		} else {
+			row, _ = strconv.Atoi(m[5])
+		}
+	}
+	return events, row, true
+}
+
+// mouseEnabled reports whether the mouse reports should be turned on. In
+// the inline mode, the mouse is left to the terminal by default to select
+// the text of the dump.
+func (app *Application) mouseEnabled() bool {
+	switch app.mouse {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	return app.fullScreen
+}
+
+// suspendMouse turns off the mouse reports until the next drawing, so
+// that the prompts do not read them as the keys typed.
+func (app *Application) suspendMouse() {
+	if app.mouseOn {
+		io.WriteString(app.out, _ANSI_MOUSE_OFF)
+		app.mouseOn = false
+	}
+}
+
+// selection is the range of the bytes selected by dragging. The other
+// end is the cursor.
+type selection struct {
+	anchor int64
+}
+
+// selRange is the range of the addresses [start, end).
+type selRange struct {
+	start, end int64
+}
+
+func (s selRange) contains(address int64) bool {
+	return s.start <= address && address < s.end
+}
+
+// selectedRange returns the range of the selection, which is empty without
+// the selection.
+func (app *Application) selectedRange() selRange {
+	if app.selection == nil {
+		return selRange{}
+	}
+	start, end := app.selection.anchor, app.cursor.Address()
+	if start > end {
+		start, end = end, start
+	}
+	return selRange{start: start, end: end + 1}
+}
+
+// handleTerminalReports processes the mouse reports. The inline screen
+// does not know the row where it starts. So the reports wait for the
+// answer of the cursor position requested while the cursor is on the
+// status line.
+func (app *Application) handleTerminalReports(events []mouseEvent, row int) {
+	if len(events) <= 0 && app.pendingMouse == nil {
+		return
+	}
+	switch {
+	case app.fullScreen:
+		app.viewTop = 2 // below the ruler
+	case row > 0 && app.pendingMouse != nil:
+		app.viewTop = row - app.viewLines
+		events = append(app.pendingMouse, events...)
+		app.pendingMouse = nil
+	default:
+		if app.pendingMouse == nil {
+			io.WriteString(app.out, _ANSI_REPORT_CURSOR)
+		}
+		app.pendingMouse = append(app.pendingMouse, events...)
+		return
+	}
+	for _, ev := range events {
+		app.handleMouse(ev)
+	}
+}
+
+// addressAt returns the address of the byte drawn at the column x and the
+// row y of the screen. bit is the bit there in the bit view, or -1.
+func (app *Application) addressAt(x, y int) (address int64, bit int, ok bool) {
+	row := y - app.viewTop
+	if row < 0 || row >= app.dataHeight() {
+		return 0, -1, false
+	}
+	col := x - 1
+	lineSize := app.lineSize()
+	format := app.currentByteFormat()
+	hexStart := 8 + 1
+	cellWidth := format.width + 1
+	textStart := hexStart + lineSize*cellWidth
+	i := -1
+	bit = -1
+	if hexStart <= col && col < textStart-1 {
+		i = (col - hexStart) / cellWidth
+		if within := (col - hexStart) % cellWidth; app.bitView != nil && within < format.width {
+			bit = within
+		}
+	} else {
+		for pane := 0; pane < app.panes(); pane++ {
+			start := textStart + pane*(lineSize+1)
+			if start <= col && col < start+lineSize {
+				i = col - start
+			}
+		}
+	}
+	if i < 0 {
+		return 0, -1, false
+	}
+	address = app.window.Address() + int64(row*lineSize+i)
+	if address >= app.buffer.Len() {
+		return 0, -1, false
+	}
+	return address, bit, true
+}
+
+// scroll moves the window by the lines keeping the cursor in it.
+func (app *Application) scroll(lines int) {
+	lineSize := int64(app.lineSize())
+	height := int64(app.dataHeight())
+	for ; lines > 0; lines-- {
+		if app.window.Address()+lineSize*height >= app.buffer.Len() {
+			break
+		}
+		app.window.Skip(lineSize)
+		if app.cursor.Address() < app.window.Address() {
+			app.cursor.Skip(lineSize)
+		}
+	}
+	for ; lines < 0; lines++ {
+		if app.window.Address() < lineSize {
+			break
+		}
+		app.window.Rewind(lineSize)
+		if app.cursor.Address() >= app.window.Address()+lineSize*height {
+			app.cursor.Rewind(lineSize)
+		}
+	}
+}
+
+// handleMouse moves the cursor to the clicked byte, selects the bytes by
+// dragging and scrolls by the wheel.
+func (app *Application) handleMouse(ev mouseEvent) {
+	button := ev.button &^ mouseModifiers
+	if hv := app.help; hv != nil {
+		switch button {
+		case mouseWheelUp:
+			hv.top -= wheelLines
+		case mouseWheelDown:
+			hv.top += wheelLines
+		}
+		return
+	}
+	before := app.cursor.Address()
+	switch {
+	case button == mouseWheelUp:
+		app.scroll(-wheelLines)
+	case button == mouseWheelDown:
+		app.scroll(wheelLines)
+	case ev.release:
+	case button == mouseLeft || button == mouseLeft|mouseMotion:
+		address, bit, ok := app.addressAt(ev.x, ev.y)
+		if !ok {
+			return
+		}
+		if button&mouseMotion == 0 {
+			app.selection = nil
+		} else if app.selection == nil {
+			app.selection = &selection{anchor: app.cursor.Address()}
+		}
+		gotoAddress(app, address)
+		if bit >= 0 {
+			app.bitView.bit = bit
+		}
+	}
+	if app.typing != nil && app.cursor.Address() != before {
+		app.typing.cursorMoved()
+	}
+}
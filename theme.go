@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// byteClass is the kind of a byte used to color it.
+type byteClass int
+
+const (
+	classNull       byteClass = iota // 0x00
+	classFF                          // 0xFF
+	classPrintable                   // printable ASCII
+	classWhitespace                  // space, TAB, LF, CR, VT and FF
+	classControl                     // other ASCII controls and DEL
+	classHigh                        // 0x80-0xFE
+	numByteClasses
+)
+
+func classOfByte(b byte) byteClass {
+	switch {
+	case b == 0x00:
+		return classNull
+	case b == 0xFF:
+		return classFF
+	case b == ' ' || '\t' <= b && b <= '\r':
+		return classWhitespace
+	case b < 0x20 || b == 0x7F:
+		return classControl
+	case b < 0x80:
+		return classPrintable
+	}
+	return classHigh
+}
+
+// classOfRune returns the class of the decoded character to color it
+// as the bytes in the hex part.
+func classOfRune(r rune) byteClass {
+	switch {
+	case r == 0:
+		return classNull
+	case r < 0x80:
+		return classOfByte(byte(r))
+	case unicode.IsSpace(r):
+		return classWhitespace
+	case unicode.IsControl(r):
+		return classControl
+	}
+	return classHigh
+}
+
+// theme is the set of colors. Each field is the parameters of SGR
+// (e.g. "33", "38;5;214", "38;2;255;175;0"). The background is added to
+// all colors but status.
+type theme struct {
+	background  string
+	class       [numByteClasses]string
+	address     string
+	cursor      string
+	invalid     string
+	forbidden   string
+	placeholder string
+	selection   string // added to the colors of the selected bytes
+	status      string
+	bold        string // for every other group of four bytes
+}
+
+var themes = map[string]*theme{
+	"dark": {
+		background:  "40",
+		class:       [numByteClasses]string{"90", "34", "36", "32", "35", "33"},
+		address:     "37;1",
+		cursor:      "37;1;7",
+		invalid:     "31;1",
+		forbidden:   "35;1",
+		placeholder: "94",
+		selection:   "7",
+		status:      "0;33;1",
+		bold:        "1",
+	},
+	"light": {
+		background:  "107",
+		class:       [numByteClasses]string{"90", "94", "30", "32", "35", "33"},
+		address:     "30;1",
+		cursor:      "30;1;7",
+		invalid:     "31;1",
+		forbidden:   "35;1",
+		placeholder: "34",
+		selection:   "7",
+		status:      "0;34;1",
+		bold:        "1",
+	},
+	"256": {
+		background: "48;5;234",
+		class: [numByteClasses]string{
+			"38;5;242", "38;5;33", "38;5;51", "38;5;78", "38;5;171", "38;5;214",
+		},
+		address:     "38;5;250;1",
+		cursor:      "38;5;231;1;7",
+		invalid:     "38;5;196;1",
+		forbidden:   "38;5;201;1",
+		placeholder: "38;5;75",
+		selection:   "7",
+		status:      "0;38;5;220;1",
+		bold:        "1",
+	},
+	"truecolor": {
+		background: "48;2;40;42;54",
+		class: [numByteClasses]string{
+			"38;2;98;114;164", "38;2;139;233;253", "38;2;248;248;242",
+			"38;2;80;250;123", "38;2;255;121;198", "38;2;255;184;108",
+		},
+		address:     "38;2;189;147;249;1",
+		cursor:      "38;2;248;248;242;1;7",
+		invalid:     "38;2;255;85;85;1",
+		forbidden:   "38;2;255;121;198;1",
+		placeholder: "38;2;139;233;253",
+		selection:   "7",
+		status:      "0;38;2;241;250;140;1",
+		bold:        "1",
+	},
+	// "mono" uses reverse video, bold and underline only (for NO_COLOR).
+	"mono": {
+		cursor:    "7",
+		invalid:   "7",
+		forbidden: "7",
+		selection: "1",
+	},
+}
+
+const defaultThemeName = "dark"
+
+// sgr returns the escape sequence of SGR with the non-empty parameters.
+// Without them, it returns "" not to reset the attributes.
+func sgr(params ...string) string {
+	var list []string
+	for _, p := range params {
+		if p != "" {
+			list = append(list, p)
+		}
+	}
+	if len(list) <= 0 {
+		return ""
+	}
+	return "\x1B[" + strings.Join(list, ";") + "m"
+}
+
+// the escape sequences made from the current theme by applyTheme
+var (
+	_STATUS_COLOR_ON      string
+	_CURSOR_COLOR_ON      string
+	_CELL2_COLOR_ON       string
+	_INVALID_COLOR_ON     string
+	_FORBIDDEN_COLOR_ON   string
+	_PLACEHOLDER_COLOR_ON string
+	_SELECTION_COLOR_ON   string
+
+	classColors [numByteClasses][2]string
+)
+
+func applyTheme(t *theme) {
+	_STATUS_COLOR_ON = sgr(t.status)
+	_CURSOR_COLOR_ON = sgr(t.cursor, t.background)
+	_CELL2_COLOR_ON = sgr(t.address, t.background)
+	_INVALID_COLOR_ON = sgr(t.invalid, t.background)
+	_FORBIDDEN_COLOR_ON = sgr(t.forbidden, t.background)
+	_PLACEHOLDER_COLOR_ON = sgr(t.placeholder, t.background, "22")
+	_SELECTION_COLOR_ON = sgr(t.selection)
+	for i, fg := range t.class {
+		classColors[i][0] = sgr(fg, t.background, "22")
+		classColors[i][1] = sgr(fg, t.background, t.bold)
+	}
+}
+
+func init() {
+	applyTheme(themes[defaultThemeName])
+}
+
+// classColor returns the escape sequence for the byte class. bold is for
+// every other group of four bytes in the hex part.
+func classColor(class byteClass, bold bool) string {
+	if bold {
+		return classColors[class][1]
+	}
+	return classColors[class][0]
+}
+
+// readTheme reads the theme file which consists of lines like
+// `key = SGR parameters`. The key `base` is the name of the built-in theme
+// to modify.
+func readTheme(r io.Reader) (*theme, error) {
+	t := *themes[defaultThemeName]
+	fields := map[string]*string{
+		"background":  &t.background,
+		"null":        &t.class[classNull],
+		"ff":          &t.class[classFF],
+		"printable":   &t.class[classPrintable],
+		"whitespace":  &t.class[classWhitespace],
+		"control":     &t.class[classControl],
+		"high":        &t.class[classHigh],
+		"address":     &t.address,
+		"cursor":      &t.cursor,
+		"invalid":     &t.invalid,
+		"forbidden":   &t.forbidden,
+		"placeholder": &t.placeholder,
+		"selection":   &t.selection,
+		"status":      &t.status,
+		"bold":        &t.bold,
+	}
+	err := readKeyValues(r, func(key, value string) error {
+		key = strings.ToLower(key)
+		if key == "base" {
+			base, ok := themes[value]
+			if !ok {
+				return fmt.Errorf("%s: no such theme", value)
+			}
+			t = *base
+			return nil
+		}
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("%s: unknown key", key)
+		}
+		*field = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// loadTheme applies the built-in theme of the name or the theme file of
+// the path. The empty name means the default one, which is "mono" when
+// the environment variable NO_COLOR is set.
+func loadTheme(name string) error {
+	if name == "" {
+		name = defaultThemeName
+		if os.Getenv("NO_COLOR") != "" {
+			name = "mono"
+		}
+	}
+	if t, ok := themes[name]; ok {
+		applyTheme(t)
+		return nil
+	}
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	t, err := readTheme(fd)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	applyTheme(t)
+	return nil
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/hymkor/binview/internal/large"
+)
+
+const (
+	_KEY_BACKSPACE = "\b"
+	_KEY_DEL_ASCII = "\x7F" // BACKSPACE on most terminals of Linux
+	_KEY_TAB       = "\t"
+	_KEY_INSERT    = "\x1B[2~"
+)
+
+// cursorMode tells makeLineImage how to draw the cursor.
+type cursorMode int
+
+const (
+	cursorOnBoth       cursorMode = iota // not typing
+	cursorOnHighNibble                   // typing hex digits
+	cursorOnLowNibble
+	cursorOnText // typing characters
+	cursorOnBit  // the bit view: cursorOnBit + n is on the n-th bit from the left
+)
+
+// column returns the column of the cell to be highlighted alone or -1.
+func (mode cursorMode) column(format byteFormat) int {
+	switch {
+	case format.nibbles && mode == cursorOnHighNibble:
+		return 0
+	case format.nibbles && mode == cursorOnLowNibble:
+		return 1
+	case mode >= cursorOnBit:
+		return int(mode - cursorOnBit)
+	}
+	return -1
+}
+
+const (
+	hexPane = iota
+	textPane
+)
+
+// typingEdit is one change made while typing. Backspace reverts the
+// latest one and moves the cursor back to where it was made.
+type typingEdit struct {
+	address int64
+	nibble  int
+	pastEnd bool
+	undo    func(app *Application)
+}
+
+// typingSession is the state while keys are typed directly into the data
+// (`R`, `I`, TAB). All edits made until ESC are collected into one undo entry.
+type typingSession struct {
+	pane     int
+	insert   bool
+	nibble   int  // 0: the high nibble, 1: the low nibble
+	pastEnd  bool // the text typed next is appended after the last byte
+	orgDirty bool
+	edits    []typingEdit
+}
+
+func (ts *typingSession) ModeString() string {
+	pane := "HEX"
+	if ts.pane == textPane {
+		pane = "TEXT"
+	}
+	if ts.insert {
+		return pane + " INSERT"
+	}
+	return pane + " REPLACE"
+}
+
+func hexDigitValue(key string) (byte, bool) {
+	if len(key) != 1 {
+		return 0, false
+	}
+	c := key[0]
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// isPrintableKey reports whether the key is one character which typing
+// modes must consume instead of passing it to the jumpTable.
+func isPrintableKey(key string) bool {
+	return len(key) > 0 && key[0] >= ' ' && key[0] != '\x7F'
+}
+
+// resetPointers rebuilds the cursor and the window after the blocks of
+// the buffer were changed.
+func (app *Application) resetPointers(cursorAddress int64) {
+	app.window = large.NewPointerAt(app.window.Address(), app.buffer)
+	app.cursor = large.NewPointerAt(cursorAddress, app.buffer)
+}
+
+// replaceBytes replaces `size` bytes at the address with newBytes.
+// The address may be equal to the length of the buffer to append.
+// It returns the function to restore them.
+func replaceBytes(app *Application, address int64, size int, newBytes []byte) func(*Application) {
+	oldBytes := make([]byte, 0, size)
+	if address < app.buffer.Len() {
+		p := large.NewPointerAt(address, app.buffer)
+		for len(oldBytes) < size {
+			oldBytes = append(oldBytes, p.Value())
+			if p.Next() != nil {
+				break
+			}
+		}
+	}
+	common := len(oldBytes)
+	if len(newBytes) < common {
+		common = len(newBytes)
+	}
+	if common > 0 {
+		p := large.NewPointerAt(address, app.buffer)
+		for i := 0; i < common; i++ {
+			if i > 0 {
+				p.Next()
+			}
+			p.SetValue(newBytes[i])
+		}
+	}
+	for i := common; i < len(oldBytes); i++ {
+		large.NewPointerAt(address+int64(common), app.buffer).Remove()
+	}
+	if rest := newBytes[common:]; len(rest) > 0 {
+		if at := address + int64(common); at < app.buffer.Len() {
+			p := large.NewPointerAt(at, app.buffer)
+			copy(p.InsertSpace(len(rest)), rest)
+		} else {
+			p := large.NewPointerAt(app.buffer.Len()-1, app.buffer)
+			copy(p.AppendSpace(len(rest)), rest)
+		}
+	}
+	newSize := len(newBytes)
+	return func(app *Application) {
+		replaceBytes(app, address, newSize, oldBytes)
+	}
+}
+
+func (ts *typingSession) overwriteNibble(app *Application, digit byte) {
+	address := app.cursor.Address()
+	orgValue := app.cursor.Value()
+	ts.edits = append(ts.edits, typingEdit{
+		address: address,
+		nibble:  ts.nibble,
+		undo: func(app *Application) {
+			p := large.NewPointerAt(address, app.buffer)
+			p.SetValue(orgValue)
+		},
+	})
+	if ts.nibble == 0 {
+		app.cursor.SetValue(orgValue&0x0F | digit<<4)
+		ts.nibble = 1
+	} else {
+		app.cursor.SetValue(orgValue&0xF0 | digit)
+		if app.cursor.Next() == nil {
+			ts.nibble = 0
+		}
+	}
+	app.dirty = true
+}
+
+// insertNibble inserts a new byte whose high nibble is the digit before
+// the cursor. The low nibble typed next overwrites it by overwriteNibble.
+func (ts *typingSession) insertNibble(app *Application, digit byte) {
+	address := app.cursor.Address()
+	ts.edits = append(ts.edits, typingEdit{
+		address: address,
+		undo: func(app *Application) {
+			p := large.NewPointerAt(address, app.buffer)
+			p.Remove()
+		},
+	})
+	app.cursor.Insert(digit << 4)
+	ts.nibble = 1
+	app.dirty = true
+}
+
+// typeText writes the text encoded with the current encoding at the cursor.
+// On overwriting, the whole character under the cursor is replaced even if
+// its length differs from the new one.
+func (ts *typingSession) typeText(app *Application, text string) {
+	bytes, err := app.encoding.EncodeFromString(text)
+	if err != nil {
+		app.message = err.Error()
+		return
+	}
+	if len(bytes) <= 0 {
+		return
+	}
+	start := app.cursor.Address()
+	size := 0
+	if ts.pastEnd {
+		start = app.buffer.Len()
+	} else if !ts.insert {
+		size = 1
+		theRune, posInRune, lenOfRune := app.encoding.RuneOver(app.cursor.Clone())
+		if theRune != utf8.RuneError {
+			start -= int64(posInRune)
+			size = lenOfRune
+		}
+	}
+	undo := replaceBytes(app, start, size, bytes)
+	ts.edits = append(ts.edits, typingEdit{
+		address: app.cursor.Address(),
+		pastEnd: ts.pastEnd,
+		undo:    undo,
+	})
+	next := start + int64(len(bytes))
+	app.resetPointers(next)
+	ts.pastEnd = app.cursor.Address() < next
+	app.dirty = true
+}
+
+func (ts *typingSession) backspace(app *Application) {
+	if len(ts.edits) <= 0 {
+		return
+	}
+	tail := len(ts.edits) - 1
+	edit := ts.edits[tail]
+	ts.edits = ts.edits[:tail]
+	edit.undo(app)
+	app.resetPointers(edit.address)
+	ts.nibble = edit.nibble
+	ts.pastEnd = edit.pastEnd
+	if len(ts.edits) <= 0 {
+		app.dirty = ts.orgDirty
+	}
+}
+
+// commit registers the edits made until now as one undo entry inserted
+// at the position `at` of app.undoFuncs.
+func (ts *typingSession) commit(app *Application, at int) {
+	if len(ts.edits) <= 0 {
+		return
+	}
+	edits := ts.edits
+	orgDirty := ts.orgDirty
+	undo := func(app *Application) {
+		for i := len(edits) - 1; i >= 0; i-- {
+			edits[i].undo(app)
+		}
+		app.dirty = orgDirty
+	}
+	app.undoFuncs = append(app.undoFuncs[:at], append([]func(*Application){undo}, app.undoFuncs[at:]...)...)
+	ts.edits = nil
+	ts.orgDirty = app.dirty
+}
+
+// finish ends the session and registers all its edits as one undo entry.
+func (ts *typingSession) finish(app *Application) {
+	app.typing = nil
+	ts.commit(app, len(app.undoFuncs))
+}
+
+// Key processes the key typed in the session. It returns false when the
+// key should be processed by the jumpTable (e.g. cursor motions).
+func (ts *typingSession) Key(app *Application, key string) bool {
+	switch key {
+	case _KEY_ESC, _KEY_ENTER:
+		ts.finish(app)
+		return true
+	case _KEY_BACKSPACE, _KEY_DEL_ASCII:
+		ts.backspace(app)
+		return true
+	case _KEY_TAB:
+		if ts.pane == hexPane {
+			ts.pane = textPane
+		} else {
+			ts.pane = hexPane
+		}
+		ts.nibble = 0
+		ts.pastEnd = false
+		return true
+	case _KEY_INSERT:
+		ts.insert = !ts.insert
+		return true
+	}
+	if ts.pane == textPane {
+		if isPrintableKey(key) {
+			ts.typeText(app, key)
+			return true
+		}
+	} else {
+		if digit, ok := hexDigitValue(key); ok {
+			if ts.insert && ts.nibble == 0 {
+				ts.insertNibble(app, digit)
+			} else {
+				ts.overwriteNibble(app, digit)
+			}
+			return true
+		}
+		if isPrintableKey(key) {
+			return true
+		}
+	}
+	ts.cursorMoved()
+	return false
+}
+
+// cursorMoved forgets the half-typed byte and the end of the data reached
+// by typing when the cursor is moved by other than typing.
+func (ts *typingSession) cursorMoved() {
+	ts.nibble = 0
+	ts.pastEnd = false
+}
+
+// startTyping starts the typing session instead of the bit view.
+func (app *Application) startTyping(ts *typingSession) {
+	app.bitView = nil
+	app.typing = ts
+}
+
+// keyFuncReplaceMode starts to overwrite the data by typing hex digits.
+func keyFuncReplaceMode(app *Application) error {
+	app.startTyping(&typingSession{orgDirty: app.dirty})
+	return nil
+}
+
+// keyFuncInsertMode starts to insert the data before the cursor by typing
+// hex digits.
+func keyFuncInsertMode(app *Application) error {
+	app.startTyping(&typingSession{insert: true, orgDirty: app.dirty})
+	return nil
+}
+
+// keyFuncTextMode starts to overwrite the data by typing characters
+// encoded with the current encoding.
+func keyFuncTextMode(app *Application) error {
+	app.startTyping(&typingSession{pane: textPane, orgDirty: app.dirty})
+	return nil
+}
+
+func (app *Application) cursorMode() cursorMode {
+	if app.bitView != nil {
+		return cursorOnBit + cursorMode(app.bitView.bit)
+	}
+	if app.typing == nil {
+		return cursorOnBoth
+	}
+	if app.typing.pane == textPane {
+		return cursorOnText
+	}
+	if app.typing.nibble == 0 {
+		return cursorOnHighNibble
+	}
+	return cursorOnLowNibble
+}
+
+// handleKey dispatches the key to the mouse, the help screen, the typing
+// session, the bit view or the jumpTable.
+func (app *Application) handleKey(key string) error {
+	if events, row, ok := parseTerminalReports(key); ok {
+		app.handleTerminalReports(events, row)
+		return nil
+	}
+	if hv := app.help; hv != nil {
+		hv.Key(app, key)
+		return nil
+	}
+	ts := app.typing
+	if ts != nil && ts.Key(app, key) {
+		return nil
+	}
+	if bs := app.bitView; bs != nil && bs.Key(app, key) {
+		return nil
+	}
+	if app.selection != nil && key == _KEY_ESC {
+		app.selection = nil
+		return nil
+	}
+	cmd, ok := lookupCommand(jumpTable[key])
+	if !ok {
+		return nil
+	}
+	// the command may read keys with a prompt
+	app.suspendMouse()
+	undoCount := len(app.undoFuncs)
+	err := cmd.f(app)
+	if len(app.undoFuncs) != undoCount {
+		// the addresses of the selected bytes may be changed
+		app.selection = nil
+	}
+	if ts != nil && len(app.undoFuncs) > undoCount {
+		// The command changed the data by itself. Keep the undo order by
+		// committing what was typed before it.
+		ts.commit(app, undoCount)
+	}
+	return err
+}